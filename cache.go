@@ -0,0 +1,192 @@
+package mdns
+
+import (
+	"container/list"
+	"fmt"
+	"golang.org/x/net/dns/dnsmessage"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheFlushBit is the top bit of the class field, used by responders to tell
+// queriers that a record replaces all previously cached ones (RFC 6762 §10.2).
+const cacheFlushBit = 1 << 15
+
+// defaultCacheSize is the number of records a cache holds unless changed with
+// WithCacheSize.
+const defaultCacheSize = 4096
+
+type cacheEntry struct {
+	key      string
+	rrset    string
+	source   string
+	resource dnsmessage.Resource
+	created  time.Time
+	expires  time.Time
+	elem     *list.Element
+}
+
+// remaining returns the fraction of the entry's lifetime left at now.
+func (e *cacheEntry) remaining(now time.Time) float64 {
+	var lifetime = e.expires.Sub(e.created)
+	if lifetime <= 0 {
+		return 0
+	}
+	return float64(e.expires.Sub(now)) / float64(lifetime)
+}
+
+// refreshAfter returns the first point after now at which a querier should
+// re-query for the entry: 80%, 85%, 90% and 95% of its lifetime (RFC 6762 §5.2).
+func (e *cacheEntry) refreshAfter(now time.Time) (time.Time, bool) {
+	var lifetime = e.expires.Sub(e.created)
+	for _, percent := range []time.Duration{80, 85, 90, 95} {
+		var at = e.created.Add(lifetime * percent / 100)
+		if at.After(now) {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// cache holds the records learned from responses, keyed by name, type, class
+// and rdata, and indexed by rrset for cache flushes. It holds at most size
+// records, evicting the least recently used one, and at most quota records
+// from one source if quota is greater than zero.
+type cache struct {
+	mu      sync.Mutex
+	size    int
+	quota   int
+	entries map[string]*cacheEntry
+	rrsets  map[string]map[*cacheEntry]struct{}
+	lru     *list.List
+	sources map[string]int
+}
+
+func newCache(size, quota int) *cache {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	return &cache{
+		size:    size,
+		quota:   quota,
+		entries: make(map[string]*cacheEntry),
+		rrsets:  make(map[string]map[*cacheEntry]struct{}),
+		lru:     list.New(),
+		sources: make(map[string]int),
+	}
+}
+
+func cacheKey(resource dnsmessage.Resource) string {
+	return recordKey(rrsetKey(resource.Header), resource)
+}
+
+// recordKey returns the cacheKey of resource from the key of its rrset.
+func recordKey(rrset string, resource dnsmessage.Resource) string {
+	var body string
+	if resource.Body != nil {
+		body = resource.Body.GoString()
+	}
+	return rrset + "|" + body
+}
+
+func rrsetKey(header dnsmessage.ResourceHeader) string {
+	return fmt.Sprintf("%s|%d|%d", strings.ToLower(header.Name.String()), header.Type, header.Class&^cacheFlushBit)
+}
+
+// add stores resource received from source at now, and reports whether it was
+// stored. A TTL of zero announces that the record is going away, so it is kept
+// for one more second (RFC 6762 §10.1).
+func (c *cache) add(source string, resource dnsmessage.Resource, now time.Time) bool {
+	var ttl = time.Duration(resource.Header.TTL) * time.Second
+	if ttl == 0 {
+		ttl = time.Second
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var rrset = rrsetKey(resource.Header)
+	if resource.Header.Class&cacheFlushBit != 0 {
+		for entry := range c.rrsets[rrset] {
+			if now.Sub(entry.created) > time.Second {
+				c.remove(entry)
+			}
+		}
+	}
+
+	resource.Header.Class &^= cacheFlushBit
+	var key = recordKey(rrset, resource)
+	if entry, ok := c.entries[key]; ok {
+		c.remove(entry)
+	} else if c.quota > 0 && c.sources[source] >= c.quota {
+		return false
+	}
+
+	for len(c.entries) >= c.size {
+		c.remove(c.lru.Back().Value.(*cacheEntry))
+	}
+
+	var entry = &cacheEntry{key: key, rrset: rrset, source: source, resource: resource, created: now, expires: now.Add(ttl)}
+	entry.elem = c.lru.PushFront(entry)
+	c.entries[key] = entry
+	if c.rrsets[rrset] == nil {
+		c.rrsets[rrset] = make(map[*cacheEntry]struct{})
+	}
+	c.rrsets[rrset][entry] = struct{}{}
+	c.sources[source]++
+	return true
+}
+
+// remove deletes entry. It must be called with c.mu held.
+func (c *cache) remove(entry *cacheEntry) {
+	delete(c.entries, entry.key)
+	if delete(c.rrsets[entry.rrset], entry); len(c.rrsets[entry.rrset]) == 0 {
+		delete(c.rrsets, entry.rrset)
+	}
+	c.lru.Remove(entry.elem)
+	if c.sources[entry.source]--; c.sources[entry.source] <= 0 {
+		delete(c.sources, entry.source)
+	}
+}
+
+// answers returns the live entries that answer question at now. Only
+// questions of type ANY or class ANY look beyond the rrset of the question.
+func (c *cache) answers(question dnsmessage.Question, now time.Time) []*cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entries []*cacheEntry
+	var visit = func(entry *cacheEntry) {
+		if !entry.expires.After(now) {
+			c.remove(entry)
+			return
+		}
+		if answers(question, entry.resource.Header) {
+			c.lru.MoveToFront(entry.elem)
+			entries = append(entries, entry)
+		}
+	}
+
+	if question.Type == dnsmessage.TypeALL || question.Class&^cacheFlushBit == dnsmessage.ClassANY {
+		for _, entry := range c.entries {
+			visit(entry)
+		}
+		return entries
+	}
+	for entry := range c.rrsets[rrsetKey(dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: question.Class})] {
+		visit(entry)
+	}
+	return entries
+}
+
+func answers(question dnsmessage.Question, header dnsmessage.ResourceHeader) bool {
+	if question.Type != dnsmessage.TypeALL && question.Type != header.Type {
+		return false
+	}
+	var class = question.Class &^ cacheFlushBit
+	if class != dnsmessage.ClassANY && class != header.Class&^cacheFlushBit {
+		return false
+	}
+	return strings.EqualFold(question.Name.String(), header.Name.String())
+}
@@ -0,0 +1,110 @@
+package mdns
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func aRecord(name string, ip byte, flush bool) dnsmessage.Resource {
+	var class = dnsmessage.ClassINET
+	if flush {
+		class |= cacheFlushBit
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: class, TTL: 120},
+		Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, ip}},
+	}
+}
+
+func TestCacheFlush(t *testing.T) {
+	var c = newCache(0, 0)
+	var start = time.Unix(0, 0)
+	c.add("a", aRecord("printer.local.", 1, false), start)
+	c.add("a", aRecord("printer.local.", 2, false), start)
+	c.add("a", aRecord("scanner.local.", 3, false), start)
+
+	c.add("a", aRecord("PRINTER.local.", 4, true), start.Add(2*time.Second))
+
+	var question = dnsmessage.Question{Name: dnsmessage.MustNewName("printer.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}
+	var entries = c.answers(question, start.Add(2*time.Second))
+	if len(entries) != 1 || entries[0].resource.Body.(*dnsmessage.AResource).A[3] != 4 {
+		t.Fatalf("printer.local. has %d records after a flush, want the new one only", len(entries))
+	}
+	question.Name = dnsmessage.MustNewName("scanner.local.")
+	if entries = c.answers(question, start.Add(2*time.Second)); len(entries) != 1 {
+		t.Fatalf("scanner.local. has %d records, want 1", len(entries))
+	}
+}
+
+func TestCacheAnswers(t *testing.T) {
+	var c = newCache(0, 0)
+	var start = time.Unix(0, 0)
+	c.add("a", aRecord("printer.local.", 1, false), start)
+	c.add("a", aRecord("scanner.local.", 2, false), start)
+	c.add("a", dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("printer.local."), Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 1},
+		Body:   &dnsmessage.TXTResource{TXT: []string{"rp=queue"}},
+	}, start)
+
+	var tests = []struct {
+		name  string
+		qName string
+		qType dnsmessage.Type
+		class dnsmessage.Class
+		at    time.Duration
+		want  int
+	}{
+		{"rrset", "printer.local.", dnsmessage.TypeA, dnsmessage.ClassINET, 0, 1},
+		{"case", "PRINTER.local.", dnsmessage.TypeA, dnsmessage.ClassINET, 0, 1},
+		{"QU", "printer.local.", dnsmessage.TypeA, dnsmessage.ClassINET | unicastResponseBit, 0, 1},
+		{"type ANY", "printer.local.", dnsmessage.TypeALL, dnsmessage.ClassINET, 0, 2},
+		{"class ANY", "printer.local.", dnsmessage.TypeA, dnsmessage.ClassANY, 0, 1},
+		{"other type", "scanner.local.", dnsmessage.TypeTXT, dnsmessage.ClassINET, 0, 0},
+		{"expired", "printer.local.", dnsmessage.TypeTXT, dnsmessage.ClassINET, time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var question = dnsmessage.Question{Name: dnsmessage.MustNewName(tt.qName), Type: tt.qType, Class: tt.class}
+			if got := len(c.answers(question, start.Add(tt.at))); got != tt.want {
+				t.Fatalf("%d answers, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkCacheAnswers looks up one rrset in a full cache, as queriers do
+// for every active query on every response.
+func BenchmarkCacheAnswers(b *testing.B) {
+	var c = newCache(0, 0)
+	var now = time.Unix(0, 0)
+	for i := 0; i < defaultCacheSize; i++ {
+		c.add("a", aRecord(fmt.Sprintf("host%d.local.", i), 1, false), now)
+	}
+	var question = dnsmessage.Question{Name: dnsmessage.MustNewName("host1.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.answers(question, now)
+	}
+}
+
+// BenchmarkCacheFlush adds records with the cache-flush bit to a full cache.
+func BenchmarkCacheFlush(b *testing.B) {
+	var c = newCache(0, 0)
+	var now = time.Unix(0, 0)
+	for i := 0; i < defaultCacheSize; i++ {
+		c.add("a", aRecord(fmt.Sprintf("host%d.local.", i), 1, false), now)
+	}
+	var record = aRecord("flood.local.", 1, true)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		now = now.Add(2 * time.Second)
+		c.add("b", record, now)
+	}
+}
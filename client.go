@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/smartwalle/mdns/internal"
 	"golang.org/x/net/dns/dnsmessage"
+	"math/rand"
 	"net"
 )
 
@@ -14,31 +15,106 @@ type Client interface {
 
 	OnResource(handler func(net.Addr, Resource))
 
+	// OnMessage calls handler on every message received, with all of its
+	// sections. It is called before the OnResource handler.
+	OnMessage(handler func(net.Addr, Message))
+
 	OnWarning(handler func(net.Addr, error))
 
 	OnError(handler func(error))
 
+	// OnDrop calls handler every time a received packet is dropped, or the
+	// records of a response are not cached, with the source and the reason.
+	// The handler runs on the receive path and must return quickly.
+	OnDrop(handler func(net.Addr, DropReason))
+
+	// OnRecovery calls handler as a socket that failed with a read error is
+	// re-created, see WithRecovery. The handler must return quickly.
+	OnRecovery(handler func(RecoveryEvent))
+
 	Start(ctx context.Context) error
 
 	Send(question Question) error
 
+	// Query continuously queries for question until ctx is done or the
+	// client stops, as described in RFC 6762 §5.2. The client must be created
+	// with WithContinuousQuerying and started; otherwise ErrNotContinuous or
+	// ErrNotStarted is returned.
+	Query(ctx context.Context, question Question) error
+
+	// Close closes all connections and stops continuous queries without
+	// waiting for the goroutines started by Start, so it may be called from a
+	// handler.
 	Close() error
-}
 
-type ClientOption func(client *mClient)
+	// Stop is like Close, but waits until every goroutine started by Start has
+	// exited, or ctx is done.
+	Stop(ctx context.Context) error
+
+	// Done returns a channel that is closed once every goroutine started by
+	// the last call to Start has exited.
+	Done() <-chan struct{}
+
+	// Wait blocks until every goroutine started by the last call to Start has
+	// exited.
+	Wait()
+
+	// Stats returns a snapshot of the packet counters.
+	Stats() Stats
+}
 
 // WithReceiveMulticast 用于开启接收 Multicast 数据
 func WithReceiveMulticast() ClientOption {
-	return func(client *mClient) {
-		client.rFactory4 = &internal.IPv4PacketConnFactory{Group: &net.UDPAddr{IP: mDNSMulticastIPv4}}
-		client.rFactory6 = &internal.IPv6PacketConnFactory{Group: &net.UDPAddr{IP: mDNSMulticastIPv6}}
-	}
+	return clientOption(func(client *mClient) {
+		client.receiveMulticast = true
+	})
+}
+
+// WithCacheSize sets the number of records cached by a client made with
+// WithContinuousQuerying. Beyond it the least recently used record is
+// evicted. The default is 4096.
+func WithCacheSize(size int) ClientOption {
+	return clientOption(func(client *mClient) {
+		client.cacheSize = size
+	})
+}
+
+// WithCacheSourceQuota limits the number of records cached from one source
+// address. Records over the quota are not cached and reported through OnDrop.
+func WithCacheSourceQuota(quota int) ClientOption {
+	return clientOption(func(client *mClient) {
+		client.cacheQuota = quota
+	})
+}
+
+// WithRandSource sets the source of the random delays of a client made with
+// WithContinuousQuerying, such as the 20-120ms before the first query of a
+// question. With a FakeClock, a fixed source makes the queries predictable.
+// By default the global source of math/rand is used.
+func WithRandSource(source rand.Source) ClientOption {
+	return clientOption(func(client *mClient) {
+		client.randSource = source
+	})
+}
+
+// WithContinuousQuerying makes the client a continuous querier as described in
+// RFC 6762 §5.2: it shares port 5353 with other processes, receives multicast
+// responses, caches the records it sees and keeps the questions passed to
+// Query alive until their context is done.
+func WithContinuousQuerying() ClientOption {
+	return clientOption(func(client *mClient) {
+		client.continuous = true
+	})
 }
 
 type mClient struct {
 	*mDNS
-	rFactory4 internal.PacketConnFactory
-	rFactory6 internal.PacketConnFactory
+	receiveMulticast bool
+	continuous       bool
+	cacheSize        int
+	cacheQuota       int
+	randSource       rand.Source
+	querier          *querier
 }
 
 // NewClient creates a new object implementing the Client interface. Do not forget
@@ -46,65 +122,107 @@ type mClient struct {
 // the corresponding type, or nothing will work.
 func NewClient(opts ...ClientOption) Client {
 	var nClient = &mClient{}
-	nClient.mDNS = &mDNS{}
+	nClient.mDNS = newMDNS()
 	nClient.mDNS.conn4 = nil
 	nClient.mDNS.conn6 = nil
 
 	for _, opt := range opts {
 		if opt != nil {
-			opt(nClient)
+			opt.applyClient(nClient)
 		}
 	}
+	nClient.buildChains()
+
+	if nClient.continuous {
+		nClient.querier = newQuerier(nClient.clock, newCache(nClient.cacheSize, nClient.cacheQuota), nClient.mDNS.Multicast, func(err error) {
+			nClient.warn(nil, err)
+		}, nClient.randSource)
+		nClient.OnResource(nil)
+	}
 
 	return nClient
 }
 
 func (m *mClient) EnableIPv4() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conn4 == nil && m.continuous {
+		m.conn4 = internal.NewConn(
+			&net.UDPAddr{IP: m.group4, Port: m.port},
+			&net.UDPAddr{IP: m.bind4, Port: m.port},
+			nil,
+			m.factory4(true),
+			nil,
+			m.ttl,
+		)
+	}
 	if m.conn4 == nil {
 		var mAddr = &net.UDPAddr{
-			IP:   mDNSMulticastIPv4,
-			Port: Port,
+			IP:   m.group4,
+			Port: m.port,
 		}
 		var lAddr = &net.UDPAddr{
 			IP:   net.IPv4zero,
 			Port: 0,
 		}
 		var rAddr = &net.UDPAddr{
-			IP:   mDNSWildcardIPv4,
-			Port: Port,
+			IP:   m.bind4,
+			Port: m.port,
+		}
+		var rFactory internal.PacketConnFactory
+		if m.receiveMulticast {
+			rFactory = m.factory4(true)
 		}
 		m.conn4 = internal.NewConn(
 			mAddr,
 			lAddr,
 			rAddr,
-			&internal.IPv4PacketConnFactory{},
-			m.rFactory4,
-			-1,
+			m.factory4(false),
+			rFactory,
+			m.ttl,
 		)
 	}
 }
 
 func (m *mClient) EnableIPv6() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conn6 == nil && m.continuous {
+		m.conn6 = internal.NewConn(
+			&net.UDPAddr{IP: m.group6, Port: m.port},
+			&net.UDPAddr{IP: m.bind6, Port: m.port},
+			nil,
+			m.factory6(true),
+			nil,
+			m.ttl,
+		)
+	}
 	if m.conn6 == nil {
 		var mAddr = &net.UDPAddr{
-			IP:   mDNSMulticastIPv6,
-			Port: Port,
+			IP:   m.group6,
+			Port: m.port,
 		}
 		var lAddr = &net.UDPAddr{
 			IP:   net.IPv6zero,
 			Port: 0,
 		}
 		var rAddr = &net.UDPAddr{
-			IP:   mDNSWildcardIPv6,
-			Port: Port,
+			IP:   m.bind6,
+			Port: m.port,
+		}
+		var rFactory internal.PacketConnFactory
+		if m.receiveMulticast {
+			rFactory = m.factory6(true)
 		}
 		m.conn6 = internal.NewConn(
 			mAddr,
 			lAddr,
 			rAddr,
-			&internal.IPv6PacketConnFactory{},
-			m.rFactory6,
-			-1,
+			m.factory6(false),
+			rFactory,
+			m.ttl,
 		)
 	}
 }
@@ -116,3 +234,67 @@ func (m *mClient) Send(question Question) error {
 	}
 	return m.mDNS.Multicast(message)
 }
+
+func (m *mClient) Query(ctx context.Context, question Question) error {
+	if m.querier == nil {
+		return ErrNotContinuous
+	}
+
+	var nQuery, quit, err = m.querier.start(question)
+	if err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.querier.stop(nQuery)
+		case <-quit:
+		}
+	}()
+	return nil
+}
+
+func (m *mClient) Start(ctx context.Context) error {
+	if err := m.mDNS.Start(ctx); err != nil {
+		return err
+	}
+	if m.querier != nil {
+		var quit = m.querier.open()
+		var done = m.Done()
+		go func() {
+			<-done
+			m.querier.closeRun(quit)
+		}()
+	}
+	return nil
+}
+
+func (m *mClient) OnResource(handler func(net.Addr, Resource)) {
+	if m.querier == nil {
+		m.mDNS.OnResource(handler)
+		return
+	}
+	m.mDNS.OnResource(func(addr net.Addr, resource Resource) {
+		if rejected := m.querier.observe(addr, resource); rejected > 0 {
+			m.stats.cacheRejected.Add(uint64(rejected))
+			m.drop(addr, ReasonCacheQuota)
+		}
+		if handler != nil {
+			handler(addr, resource)
+		}
+	})
+}
+
+func (m *mClient) Close() error {
+	if m.querier != nil {
+		m.querier.close()
+	}
+	return m.mDNS.Close()
+}
+
+func (m *mClient) Stop(ctx context.Context) error {
+	if m.querier != nil {
+		m.querier.close()
+	}
+	return m.mDNS.Stop(ctx)
+}
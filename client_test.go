@@ -0,0 +1,220 @@
+package mdns_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartwalle/mdns"
+	"github.com/smartwalle/mdns/mdnstest"
+	"github.com/smartwalle/mdns/memnet"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestQueryLifecycle(t *testing.T) {
+	var network = memnet.NewNetwork()
+	var host = network.NewHost("client")
+	host.AddInterface("eth0", network.NewLink("lan"), net.IPv4(192, 0, 2, 1))
+
+	var client = mdns.NewClient(mdns.WithTransport(host), mdns.WithContinuousQuerying())
+	client.EnableIPv4()
+	var question = mdns.Question{
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("_ipp._tcp.local."), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}},
+	}
+
+	if err := client.Query(context.Background(), question); !errors.Is(err, mdns.ErrNotStarted) {
+		t.Fatalf("Query before Start: %v, want ErrNotStarted", err)
+	}
+
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var before = runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		if err := client.Query(context.Background(), question); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Query(context.Background(), question); !errors.Is(err, mdns.ErrNotStarted) {
+		t.Fatalf("Query after Stop: %v, want ErrNotStarted", err)
+	}
+
+	// The goroutines waiting for the contexts of the queries exit with the
+	// client, along with those of Start.
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() >= before; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left, %d before the queries", runtime.NumGoroutine(), before)
+		}
+	}
+}
+
+// queryScenario is a continuous client on a memnet host, driven by a
+// FakeClock, next to a server that answers for it.
+type queryScenario struct {
+	clock  *mdnstest.FakeClock
+	client mdns.Client
+	server mdns.Server
+	cached chan struct{}
+
+	mu   sync.Mutex
+	sent []sentQuery
+}
+
+type sentQuery struct {
+	at      time.Time
+	message dnsmessage.Message
+}
+
+func newQueryScenario(t *testing.T, opts ...mdns.ClientOption) *queryScenario {
+	var s = &queryScenario{
+		clock:  mdnstest.NewFakeClock(time.Unix(0, 0)),
+		cached: make(chan struct{}, 1),
+	}
+	var network = memnet.NewNetwork()
+	var lan = network.NewLink("lan")
+	var clientHost = network.NewHost("client")
+	clientHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 1))
+	var serverHost = network.NewHost("server")
+	serverHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 2))
+
+	var record = func(next mdns.Outbound) mdns.Outbound {
+		return func(message dnsmessage.Message, dst *net.UDPAddr) error {
+			s.mu.Lock()
+			s.sent = append(s.sent, sentQuery{at: s.clock.Now(), message: message})
+			s.mu.Unlock()
+			return next(message, dst)
+		}
+	}
+	opts = append([]mdns.ClientOption{mdns.WithTransport(clientHost), mdns.WithClock(s.clock), mdns.WithContinuousQuerying(), mdns.WithOutbound(record)}, opts...)
+	s.client = mdns.NewClient(opts...)
+	s.client.EnableIPv4()
+	s.client.OnResource(func(net.Addr, mdns.Resource) {
+		select {
+		case s.cached <- struct{}{}:
+		default:
+		}
+	})
+	if err := s.client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.client.Stop(context.Background()) })
+
+	s.server = mdns.NewServer(mdns.WithTransport(serverHost))
+	s.server.EnableIPv4()
+	if err := s.server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.server.Stop(context.Background()) })
+	return s
+}
+
+// runUntil fires the timers of the clock in order until n queries were sent,
+// and returns them.
+func (s *queryScenario) runUntil(t *testing.T, n int) []sentQuery {
+	t.Helper()
+	for {
+		s.mu.Lock()
+		var sent = append([]sentQuery(nil), s.sent...)
+		s.mu.Unlock()
+		if len(sent) >= n {
+			return sent
+		}
+		var next, ok = s.clock.Next()
+		if !ok {
+			t.Fatalf("no timer pending after %d queries", len(sent))
+		}
+		s.clock.Set(next)
+	}
+}
+
+var ippQuestion = mdns.Question{
+	Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("_ipp._tcp.local."), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}},
+}
+
+// fixedSource is a rand.Source that always returns the same number.
+type fixedSource int64
+
+func (s fixedSource) Int63() int64 { return int64(s) }
+func (fixedSource) Seed(int64)     {}
+
+func TestQueryIntervals(t *testing.T) {
+	// The first query waits 20ms plus a random delay of up to 100ms, here
+	// 50ms.
+	var s = newQueryScenario(t, mdns.WithRandSource(fixedSource(50*time.Millisecond)))
+	var start = s.clock.Now()
+	if err := s.client.Query(context.Background(), ippQuestion); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent = s.runUntil(t, 16)
+	if delay := sent[0].at.Sub(start); delay != 70*time.Millisecond {
+		t.Fatalf("first query after %v, want 70ms", delay)
+	}
+	var want = time.Second
+	for i := 1; i < len(sent); i++ {
+		if got := sent[i].at.Sub(sent[i-1].at); got != want {
+			t.Fatalf("query %d after %v, want %v", i, got, want)
+		}
+		if want *= 2; want > time.Hour {
+			want = time.Hour
+		}
+	}
+}
+
+func TestQueryRefreshAndKnownAnswers(t *testing.T) {
+	var s = newQueryScenario(t)
+	if err := s.client.Query(context.Background(), ippQuestion); err != nil {
+		t.Fatal(err)
+	}
+	var first = s.runUntil(t, 1)[0].at
+
+	// The answer is cached at the time of the first query, with a TTL of 100s.
+	var err = s.server.Multicast(mdns.Resource{
+		Header: dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: ippQuestion.Questions[0].Name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: 100},
+			Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("printer._ipp._tcp.local.")},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.cached:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the response did not reach the client")
+	}
+
+	// Backoff queries at 1, 3, 7, 15, 31, 63 and 127s, and refresh queries at
+	// 80, 85, 90 and 95% of the TTL. Known answers are listed while more than
+	// half of their TTL is left.
+	var tests = []struct {
+		at  time.Duration
+		ttl uint32
+	}{
+		{0, 0}, {1, 99}, {3, 97}, {7, 93}, {15, 85}, {31, 69},
+		{63, 0}, {80, 0}, {85, 0}, {90, 0}, {95, 0}, {127, 0},
+	}
+	var sent = s.runUntil(t, len(tests))
+	for i, tt := range tests {
+		var at = sent[i].at.Sub(first)
+		var known = sent[i].message.Answers
+		if at != tt.at*time.Second {
+			t.Fatalf("query %d at %v, want %ds", i, at, tt.at)
+		}
+		if tt.ttl == 0 && len(known) != 0 {
+			t.Errorf("query at %v lists %d known answers, want none", at, len(known))
+		}
+		if tt.ttl != 0 && (len(known) != 1 || known[0].Header.TTL != tt.ttl) {
+			t.Errorf("query at %v lists known answers %v, want one with TTL %d", at, known, tt.ttl)
+		}
+	}
+}
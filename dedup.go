@@ -0,0 +1,166 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"github.com/smartwalle/mdns/internal"
+	"golang.org/x/net/dns/dnsmessage"
+	"hash/fnv"
+	"net"
+	"time"
+)
+
+// deduplicator holds received packets for a short window and merges the
+// copies of them that arrive meanwhile over the other address family or
+// other interfaces. It is only used by the receive loop of Start.
+type deduplicator struct {
+	m       *mDNS
+	window  time.Duration
+	pending map[uint64]*pendingPacket
+
+	// flush receives the keys of the packets whose window has passed.
+	flush chan uint64
+	quit  chan struct{}
+}
+
+type pendingPacket struct {
+	packet internal.Packet
+	timer  Timer
+}
+
+func (m *mDNS) newDeduplicator() *deduplicator {
+	if m.dedupWindow <= 0 {
+		return nil
+	}
+	return &deduplicator{
+		m:       m,
+		window:  m.dedupWindow,
+		pending: make(map[uint64]*pendingPacket),
+		flush:   make(chan uint64, 16),
+		quit:    make(chan struct{}),
+	}
+}
+
+// maxPendingPackets bounds the number of packets held at once. Beyond it
+// packets are handled without being held, so they are not merged.
+const maxPendingPackets = 1024
+
+// dedupKey identifies a packet by its content and its sender. A packet
+// carrying A, AAAA or SRV records names its sender, as those owner names are
+// unique to a host on the link, so its content is enough and its copies sent
+// over both families are merged. Other packets, such as plain queries or the
+// PTR records that every responder of a service type shares, may be sent
+// byte-identical by several hosts; they are also keyed by their source
+// address, so only their copies received over several interfaces are merged.
+func dedupKey(received internal.Packet) uint64 {
+	var h = fnv.New64a()
+	_, _ = h.Write(received.Data)
+	if !namesSender(received.Data) {
+		if addr, ok := received.Addr.(*net.UDPAddr); ok {
+			_, _ = h.Write(addr.IP)
+			_ = binary.Write(h, binary.BigEndian, uint16(addr.Port))
+		} else if received.Addr != nil {
+			_, _ = h.Write([]byte(received.Addr.String()))
+		}
+	}
+	return h.Sum64()
+}
+
+// namesSender reports whether data holds an A, AAAA or SRV record.
+func namesSender(data []byte) bool {
+	var parser dnsmessage.Parser
+	if _, err := parser.Start(data); err != nil {
+		return false
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return false
+	}
+
+	var sections = []struct {
+		header func() (dnsmessage.ResourceHeader, error)
+		skip   func() error
+	}{
+		{parser.AnswerHeader, parser.SkipAnswer},
+		{parser.AuthorityHeader, parser.SkipAuthority},
+		{parser.AdditionalHeader, parser.SkipAdditional},
+	}
+	for _, section := range sections {
+		for {
+			var header, err = section.header()
+			if err == dnsmessage.ErrSectionDone {
+				break
+			}
+			if err != nil {
+				return false
+			}
+			switch header.Type {
+			case dnsmessage.TypeA, dnsmessage.TypeAAAA, dnsmessage.TypeSRV:
+				return true
+			}
+			if section.skip() != nil {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// hold takes received and reports whether it was held. A copy of a held
+// packet is merged into it and released. Packets are not held once
+// maxPendingPackets are pending.
+func (d *deduplicator) hold(received internal.Packet) bool {
+	var key = dedupKey(received)
+	if p, ok := d.pending[key]; ok {
+		if !sameAddr(p.packet.Addr, received.Addr) {
+			var known bool
+			for _, addr := range p.packet.Also {
+				known = known || sameAddr(addr, received.Addr)
+			}
+			if !known {
+				p.packet.Also = append(p.packet.Also, received.Addr)
+			}
+		}
+		received.Release()
+		d.m.stats.duplicates.Add(1)
+		return true
+	}
+	if len(d.pending) >= maxPendingPackets {
+		return false
+	}
+
+	var p = &pendingPacket{packet: received}
+	p.timer = d.m.clock.AfterFunc(d.window, func() {
+		select {
+		case d.flush <- key:
+		case <-d.quit:
+		}
+	})
+	d.pending[key] = p
+	return true
+}
+
+// release returns the held packet with the given key.
+func (d *deduplicator) release(key uint64) (internal.Packet, bool) {
+	var p, ok = d.pending[key]
+	if !ok {
+		return internal.Packet{}, false
+	}
+	delete(d.pending, key)
+	return p.packet, true
+}
+
+// close releases every held packet without handling it.
+func (d *deduplicator) close() {
+	close(d.quit)
+	for key, p := range d.pending {
+		p.timer.Stop()
+		p.packet.Release()
+		delete(d.pending, key)
+	}
+}
+
+func sameAddr(a, b net.Addr) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Network() == b.Network() && a.String() == b.String()
+}
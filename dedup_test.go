@@ -0,0 +1,51 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/smartwalle/mdns/internal"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDedupKey(t *testing.T) {
+	var pack = func(answers ...dnsmessage.Resource) []byte {
+		var data, err = (&dnsmessage.Message{Header: dnsmessage.Header{Response: true}, Answers: answers}).Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	var header = func(name string, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET, TTL: 120}
+	}
+
+	var services = pack(dnsmessage.Resource{
+		Header: header("_services._dns-sd._udp.local.", dnsmessage.TypePTR),
+		Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("_ipp._tcp.local.")},
+	})
+	var host = pack(dnsmessage.Resource{
+		Header: header("printer.local.", dnsmessage.TypeA),
+		Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+	})
+
+	var v4 = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: Port}
+	var v6 = &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: Port}
+	var other = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: Port}
+
+	var tests = []struct {
+		name  string
+		a, b  internal.Packet
+		merge bool
+	}{
+		{"shared records from two hosts", internal.Packet{Data: services, Addr: v4}, internal.Packet{Data: services, Addr: other}, false},
+		{"shared records from one host", internal.Packet{Data: services, Addr: v4}, internal.Packet{Data: services, Addr: v4}, true},
+		{"host records over both families", internal.Packet{Data: host, Addr: v4}, internal.Packet{Data: host, Addr: v6}, true},
+		{"different content", internal.Packet{Data: host, Addr: v4}, internal.Packet{Data: services, Addr: v4}, false},
+	}
+	for _, test := range tests {
+		if merge := dedupKey(test.a) == dedupKey(test.b); merge != test.merge {
+			t.Errorf("%s: merged = %v, want %v", test.name, merge, test.merge)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package mdns
+
+import (
+	"github.com/smartwalle/mdns/internal"
+	"golang.org/x/net/dns/dnsmessage"
+	"hash/fnv"
+	"sync"
+)
+
+// DispatchMode selects how received packets are handed to the handlers.
+type DispatchMode int
+
+const (
+	// DispatchInline runs the handlers on the receive loop, one packet at a
+	// time. A slow handler delays every following packet.
+	DispatchInline DispatchMode = iota
+
+	// DispatchGoroutine runs the handlers of every packet in a new goroutine.
+	// Packets are handled concurrently and in no particular order.
+	DispatchGoroutine
+
+	// DispatchPool runs the handlers on a fixed set of workers, each with a
+	// bounded queue. Packets from the same source always go to the same
+	// worker, so they are handled in the order they were received.
+	DispatchPool
+)
+
+// DropPolicy decides what happens when a worker queue of DispatchPool is
+// full.
+type DropPolicy int
+
+const (
+	// DropNewest drops the packet that does not fit in the queue.
+	DropNewest DropPolicy = iota
+
+	// DropOldest drops the oldest queued packet to make room.
+	DropOldest
+
+	// DropNone blocks the receive loop until there is room, pushing back on
+	// the socket buffers.
+	DropNone
+)
+
+const (
+	defaultWorkers    = 4
+	defaultQueueDepth = 64
+)
+
+// dispatcher hands received packets to the handlers of m.
+type dispatcher interface {
+	dispatch(received internal.Packet)
+
+	// close waits until every packet accepted by dispatch has been handled.
+	close()
+}
+
+func (m *mDNS) newDispatcher() dispatcher {
+	switch m.dispatchMode {
+	case DispatchGoroutine:
+		return &goroutineDispatcher{m: m}
+	case DispatchPool:
+		return newPoolDispatcher(m, m.workers, m.queueDepth, m.dropPolicy)
+	default:
+		return &inlineDispatcher{m: m}
+	}
+}
+
+type inlineDispatcher struct {
+	m      *mDNS
+	parser dnsmessage.Parser
+}
+
+func (d *inlineDispatcher) dispatch(received internal.Packet) {
+	d.m.handle(&d.parser, received)
+}
+
+func (d *inlineDispatcher) close() {
+}
+
+type goroutineDispatcher struct {
+	m  *mDNS
+	wg sync.WaitGroup
+}
+
+// parserPool lets per-packet goroutines reuse parsers instead of allocating
+// one per packet. The other dispatchers keep one parser per goroutine.
+var parserPool = sync.Pool{
+	New: func() any {
+		return &dnsmessage.Parser{}
+	},
+}
+
+func (d *goroutineDispatcher) dispatch(received internal.Packet) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		var parser = parserPool.Get().(*dnsmessage.Parser)
+		defer parserPool.Put(parser)
+		d.m.handle(parser, received)
+	}()
+}
+
+func (d *goroutineDispatcher) close() {
+	d.wg.Wait()
+}
+
+type poolDispatcher struct {
+	m      *mDNS
+	queues []chan internal.Packet
+	policy DropPolicy
+	wg     sync.WaitGroup
+}
+
+func newPoolDispatcher(m *mDNS, workers, depth int, policy DropPolicy) *poolDispatcher {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if depth <= 0 {
+		depth = defaultQueueDepth
+	}
+
+	var d = &poolDispatcher{
+		m:      m,
+		queues: make([]chan internal.Packet, workers),
+		policy: policy,
+	}
+	for i := range d.queues {
+		var queue = make(chan internal.Packet, depth)
+		d.queues[i] = queue
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			var parser dnsmessage.Parser
+			for received := range queue {
+				m.handle(&parser, received)
+			}
+		}()
+	}
+	return d
+}
+
+func (d *poolDispatcher) dispatch(received internal.Packet) {
+	var queue = d.queues[0]
+	if received.Addr != nil && len(d.queues) > 1 {
+		var h = fnv.New32a()
+		_, _ = h.Write([]byte(received.Addr.String()))
+		queue = d.queues[h.Sum32()%uint32(len(d.queues))]
+	}
+
+	switch d.policy {
+	case DropNone:
+		queue <- received
+	case DropOldest:
+		for {
+			select {
+			case queue <- received:
+				return
+			default:
+			}
+			select {
+			case dropped := <-queue:
+				dropped.Release()
+				d.m.stats.dropped.Add(1)
+				d.m.drop(dropped.Addr, ReasonQueueFull)
+			default:
+			}
+		}
+	default:
+		select {
+		case queue <- received:
+		default:
+			received.Release()
+			d.m.stats.dropped.Add(1)
+			d.m.drop(received.Addr, ReasonQueueFull)
+		}
+	}
+}
+
+func (d *poolDispatcher) close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
@@ -0,0 +1,108 @@
+package mdns
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/smartwalle/mdns/internal"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// queryPacket returns a packet holding a query with the given ID from src.
+func queryPacket(t testing.TB, id uint16, src net.Addr) internal.Packet {
+	t.Helper()
+	var data, err = (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("printer.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return internal.Packet{Data: data, Addr: src}
+}
+
+func TestPoolDispatchOrder(t *testing.T) {
+	var m = newMDNS()
+	var mu sync.Mutex
+	var handled = make(map[string][]uint16)
+	m.OnMessage(func(src net.Addr, message Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[src.String()] = append(handled[src.String()], message.Header.ID)
+	})
+
+	var sources []net.Addr
+	for i := 0; i < 8; i++ {
+		sources = append(sources, &net.UDPAddr{IP: net.IPv4(192, 0, 2, byte(i+1)), Port: Port})
+	}
+	var d = newPoolDispatcher(m, 4, 16, DropNone)
+	for id := uint16(0); id < 100; id++ {
+		for _, src := range sources {
+			d.dispatch(queryPacket(t, id, src))
+		}
+	}
+	d.close()
+
+	for _, src := range sources {
+		var ids = handled[src.String()]
+		if len(ids) != 100 {
+			t.Fatalf("%v: handled %d packets, want 100", src, len(ids))
+		}
+		for i, id := range ids {
+			if int(id) != i {
+				t.Fatalf("%v: packet %d handled in position %d", src, id, i)
+			}
+		}
+	}
+}
+
+func TestPoolDispatchDropPolicy(t *testing.T) {
+	var tests = []struct {
+		policy  DropPolicy
+		handled []uint16
+	}{
+		{DropNewest, []uint16{1, 2, 3}},
+		{DropOldest, []uint16{1, 4, 5}},
+	}
+	for _, tt := range tests {
+		var m = newMDNS()
+		var started = make(chan struct{})
+		var release = make(chan struct{})
+		var handled []uint16
+		m.OnMessage(func(src net.Addr, message Message) {
+			if message.Header.ID == 1 {
+				close(started)
+				<-release
+			}
+			handled = append(handled, message.Header.ID)
+		})
+		var drops []DropReason
+		m.OnDrop(func(src net.Addr, reason DropReason) {
+			drops = append(drops, reason)
+		})
+
+		// The only worker blocks on the first packet, so the queue of two
+		// holds the next two and the last two do not fit.
+		var src = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: Port}
+		var d = newPoolDispatcher(m, 1, 2, tt.policy)
+		d.dispatch(queryPacket(t, 1, src))
+		<-started
+		for id := uint16(2); id <= 5; id++ {
+			d.dispatch(queryPacket(t, id, src))
+		}
+		close(release)
+		d.close()
+
+		if !reflect.DeepEqual(handled, tt.handled) {
+			t.Errorf("policy %d: handled %v, want %v", tt.policy, handled, tt.handled)
+		}
+		if !reflect.DeepEqual(drops, []DropReason{ReasonQueueFull, ReasonQueueFull}) {
+			t.Errorf("policy %d: dropped with %v, want ReasonQueueFull twice", tt.policy, drops)
+		}
+		if dropped := m.Stats().Dropped; dropped != 2 {
+			t.Errorf("policy %d: Dropped is %d, want 2", tt.policy, dropped)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package mdns
+
+import (
+	"log/slog"
+	"net"
+)
+
+// DropReason tells why a received packet, or a record it carried, was
+// dropped.
+type DropReason int
+
+const (
+	// ReasonQueueFull is reported when a worker queue of DispatchPool is full.
+	ReasonQueueFull DropReason = iota
+
+	// ReasonSourceRateLimit and ReasonGlobalRateLimit are reported for
+	// packets over the limits set with WithSourceRateLimit and
+	// WithGlobalRateLimit.
+	ReasonSourceRateLimit
+	ReasonGlobalRateLimit
+
+	// ReasonCacheQuota is reported when the records of a response are not
+	// cached because their source is over the quota set with
+	// WithCacheSourceQuota.
+	ReasonCacheQuota
+
+	// ReasonOpcode, ReasonRcode, ReasonSourcePort, ReasonHopLimit and
+	// ReasonOffLink are reported for packets dropped by the validation rules.
+	ReasonOpcode
+	ReasonRcode
+	ReasonSourcePort
+	ReasonHopLimit
+	ReasonOffLink
+
+	// ReasonOwn is reported for packets sent by this process when
+	// WithOwnPackets is set to OwnFilter.
+	ReasonOwn
+)
+
+func (r DropReason) String() string {
+	switch r {
+	case ReasonQueueFull:
+		return "queue full"
+	case ReasonSourceRateLimit:
+		return "source rate limit"
+	case ReasonGlobalRateLimit:
+		return "global rate limit"
+	case ReasonCacheQuota:
+		return "cache quota"
+	case ReasonOpcode:
+		return "non-zero opcode"
+	case ReasonRcode:
+		return "non-zero rcode"
+	case ReasonSourcePort:
+		return "wrong source port"
+	case ReasonHopLimit:
+		return "wrong hop limit"
+	case ReasonOffLink:
+		return "off-link source"
+	case ReasonOwn:
+		return "own packet"
+	}
+	return "unknown"
+}
+
+// OnDrop calls handler every time a packet is dropped, with its source and
+// the reason. The handler runs on the receive path and must return quickly.
+func (m *mDNS) OnDrop(handler func(net.Addr, DropReason)) {
+	m.hmu.Lock()
+	defer m.hmu.Unlock()
+	m.dHandler = handler
+}
+
+func (m *mDNS) drop(addr net.Addr, reason DropReason) {
+	m.log(slog.LevelDebug, "dropped packet", slog.Any("src", addr), slog.String("reason", reason.String()))
+	m.hmu.RLock()
+	var handler = m.dHandler
+	m.hmu.RUnlock()
+	if handler != nil {
+		handler(addr, reason)
+	}
+}
@@ -0,0 +1,90 @@
+package mdns
+
+import (
+	"errors"
+	"fmt"
+	"github.com/smartwalle/mdns/internal"
+)
+
+var (
+	// ErrIPv4Disabled is returned when sending to an IPv4 address without
+	// EnableIPv4.
+	ErrIPv4Disabled = errors.New("IPv4 was not enabled")
+
+	// ErrIPv6Disabled is returned when sending to an IPv6 address without
+	// EnableIPv6.
+	ErrIPv6Disabled = errors.New("IPv6 was not enabled")
+
+	// ErrNoConnection is returned by Start, Multicast and MulticastBatch if
+	// neither EnableIPv4 nor EnableIPv6 was called.
+	ErrNoConnection = errors.New("no connection active")
+
+	// ErrNotStarted is returned when sending before Start or after Stop.
+	ErrNotStarted = internal.ErrNotStarted
+
+	// ErrAlreadyStarted is returned by Start while a previous run is still
+	// going.
+	ErrAlreadyStarted = errors.New("already started")
+
+	// ErrNotContinuous is returned by Query if the client was not created
+	// with WithContinuousQuerying.
+	ErrNotContinuous = errors.New("continuous querying was not enabled")
+
+	// ErrInvalidTTL is returned by SetMulticastTTL for a TTL above 255.
+	ErrInvalidTTL = internal.ErrInvalidTTL
+)
+
+// JoinGroupError is returned by Start when the multicast group could not be
+// joined on any interface, or on some interface with WithStrictJoin. Every
+// failed interface is also reported through OnWarning as a *JoinError.
+type JoinGroupError = internal.JoinGroupError
+
+// maxMessageSize is the largest message that may be sent (RFC 6762 §17).
+const maxMessageSize = 9000
+
+// PackError is returned when a message could not be serialized.
+type PackError struct {
+	// Index is the position of the message in the batch passed to
+	// MulticastBatch, or zero.
+	Index int
+	Err   error
+}
+
+func (e *PackError) Error() string {
+	return fmt.Sprintf("packing message %d: %v", e.Index, e.Err)
+}
+
+func (e *PackError) Unwrap() error {
+	return e.Err
+}
+
+// PacketTooLargeError is returned when a serialized message is larger than
+// the 9000 bytes allowed by RFC 6762 §17.
+type PacketTooLargeError struct {
+	Size int
+	Max  int
+}
+
+func (e *PacketTooLargeError) Error() string {
+	return fmt.Sprintf("packet of %d bytes exceeds the maximum of %d", e.Size, e.Max)
+}
+
+// ValidationError is reported through OnWarning for a packet dropped by
+// ValidateHopLimit or ValidateSourceAddress.
+type ValidationError struct {
+	// Reason is ReasonHopLimit or ReasonOffLink.
+	Reason DropReason
+
+	// HopLimit is the IP TTL (IPv4) or hop limit (IPv6) of the packet.
+	HopLimit int
+
+	// IfIndex is the index of the interface the packet arrived on.
+	IfIndex int
+}
+
+func (e *ValidationError) Error() string {
+	if e.Reason == ReasonHopLimit {
+		return fmt.Sprintf("dropped packet with hop limit %d", e.HopLimit)
+	}
+	return fmt.Sprintf("dropped packet with %s on interface %d", e.Reason, e.IfIndex)
+}
@@ -0,0 +1,86 @@
+package mdns_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/smartwalle/mdns"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func txtAnnouncement(text string) mdns.Resource {
+	return mdns.Resource{
+		Header: dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("printer.local."), Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 120},
+			Body:   &dnsmessage.TXTResource{TXT: []string{text}},
+		}},
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	var small = txtAnnouncement("rp=queue")
+	var ipv4 = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: mdns.Port}
+	var ipv6 = &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: mdns.Port}
+
+	var none = mdns.NewServer()
+	var v4 = mdns.NewServer()
+	v4.EnableIPv4()
+	var v6 = mdns.NewServer()
+	v6.EnableIPv6()
+
+	var tests = []struct {
+		name string
+		send func() error
+		want error
+	}{
+		{"Multicast without connections", func() error { return none.Multicast(small) }, mdns.ErrNoConnection},
+		{"empty MulticastBatch without connections", func() error { return none.MulticastBatch() }, mdns.ErrNoConnection},
+		{"SendTo IPv4 without IPv4", func() error { return v6.SendTo(small, ipv4) }, mdns.ErrIPv4Disabled},
+		{"SendTo IPv6 without IPv6", func() error { return v4.SendTo(small, ipv6) }, mdns.ErrIPv6Disabled},
+		{"Multicast before Start", func() error { return v4.Multicast(small) }, mdns.ErrNotStarted},
+		{"SendTo before Start", func() error { return v4.SendTo(small, ipv4) }, mdns.ErrNotStarted},
+		{"MulticastTTL above 255", func() error { return v4.SetMulticastTTL(256) }, mdns.ErrInvalidTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	var client = mdns.NewClient()
+	if err := client.Send(mdns.Question{}); !errors.Is(err, mdns.ErrNoConnection) {
+		t.Errorf("Send without connections: %v, want ErrNoConnection", err)
+	}
+	if err := client.Query(context.Background(), mdns.Question{}); !errors.Is(err, mdns.ErrNotContinuous) {
+		t.Errorf("Query without continuous querying: %v, want ErrNotContinuous", err)
+	}
+}
+
+func TestPackErrors(t *testing.T) {
+	var server = mdns.NewServer()
+	server.EnableIPv4()
+
+	// A character string is at most 255 bytes long.
+	var err = server.MulticastBatch(txtAnnouncement("rp=queue"), txtAnnouncement(strings.Repeat("x", 256)))
+	var pErr *mdns.PackError
+	if !errors.As(err, &pErr) || pErr.Index != 1 {
+		t.Fatalf("packing an invalid second message: %v, want a *PackError for message 1", err)
+	}
+
+	var large = txtAnnouncement("")
+	large.Answers[0].Body = &dnsmessage.TXTResource{TXT: strings.Split(strings.Repeat(strings.Repeat("x", 200)+" ", 50), " ")}
+	err = server.Multicast(large)
+	var tooLarge *mdns.PacketTooLargeError
+	if !errors.As(err, &pErr) || pErr.Index != 0 || !errors.As(err, &tooLarge) {
+		t.Fatalf("packing a large message: %v, want a *PackError wrapping a *PacketTooLargeError", err)
+	}
+	if tooLarge.Size <= 9000 || tooLarge.Max != 9000 {
+		t.Fatalf("packet of %d bytes over a maximum of %d, want more than 9000 over 9000", tooLarge.Size, tooLarge.Max)
+	}
+}
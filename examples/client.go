@@ -12,7 +12,7 @@ import (
 func main() {
 	var name = mdns.MustName("smartwalle.local.")
 
-	var client = mdns.NewClient()
+	var client = mdns.NewClient(mdns.WithLogger(slog.Default()))
 	client.EnableIPv4()
 
 	client.OnResource(func(addr net.Addr, resource mdns.Resource) {
@@ -1,14 +1,12 @@
 module github.com/smartwalle/mdns/examples
 
-go 1.19
+go 1.21
 
 require (
 	github.com/smartwalle/mdns v0.0.0
 	golang.org/x/net v0.10.0
 )
 
-require (
-	golang.org/x/sys v0.8.0 // indirect
-)
+require golang.org/x/sys v0.8.0 // indirect
 
 replace github.com/smartwalle/mdns => ../
@@ -11,7 +11,7 @@ import (
 func main() {
 	var name = mdns.MustName("smartwalle.local.")
 
-	var server = mdns.NewServer()
+	var server = mdns.NewServer(mdns.WithLogger(slog.Default()))
 	server.EnableIPv4()
 
 	server.OnQuestion(func(addr net.Addr, question mdns.Question) {
@@ -1,7 +1,8 @@
 module github.com/smartwalle/mdns
 
-go 1.18
+go 1.21
 
-require golang.org/x/net v0.10.0
-
-require golang.org/x/sys v0.8.0 // indirect
+require (
+	golang.org/x/net v0.10.0
+	golang.org/x/sys v0.8.0
+)
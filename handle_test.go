@@ -0,0 +1,32 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/smartwalle/mdns/internal"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// BenchmarkHandle reports the allocations per packet of parsing a received
+// query and delivering it to an OnQuestion handler.
+func BenchmarkHandle(b *testing.B) {
+	var name = dnsmessage.MustNewName("printer._ipp._tcp.local.")
+	var data, err = (&dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var m = newMDNS()
+	m.OnQuestion(func(net.Addr, Question) {})
+	var parser dnsmessage.Parser
+	var src = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: Port}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.handle(&parser, internal.Packet{Data: data, Addr: src})
+	}
+}
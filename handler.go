@@ -0,0 +1,267 @@
+package mdns
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+)
+
+// unicastResponseBit is the top bit of the class field of a question, set by
+// queriers that prefer a unicast response (RFC 6762 §5.4).
+const unicastResponseBit = 1 << 15
+
+// legacyTTL caps the TTL of records in responses to legacy unicast queries
+// (RFC 6762 §6.7).
+const legacyTTL = 10
+
+// A Handler responds to a question received by a Server.
+//
+// ServeMDNS adds the records of the response to w. The response is sent once
+// every question of the query has been served; ServeMDNS must not keep w
+// after returning. If no record is added, nothing is sent, as mDNS
+// responders stay silent when they have no answer.
+type Handler interface {
+	ServeMDNS(w ResponseWriter, r *Request)
+}
+
+// The HandlerFunc type is an adapter to allow the use of ordinary functions as
+// handlers.
+type HandlerFunc func(w ResponseWriter, r *Request)
+
+// ServeMDNS calls f(w, r).
+func (f HandlerFunc) ServeMDNS(w ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// Request is one question of a received query.
+type Request struct {
+	// Question is the question to answer.
+	Question dnsmessage.Question
+
+	// Message is the complete query, including its other questions and the
+	// records the querier already knows.
+	Message Message
+
+	// Src is the address the query was received from.
+	Src net.Addr
+
+	// port is the port of the server, or zero for Port.
+	port int
+}
+
+// Unicast reports whether the querier asked for a unicast response with the
+// QU bit (RFC 6762 §5.4).
+func (r *Request) Unicast() bool {
+	return r.Question.Class&unicastResponseBit != 0
+}
+
+// Legacy reports whether the query came from a one-shot resolver that does
+// not use the mDNS port of the server, 5353 unless set with WithPort
+// (RFC 6762 §6.7).
+func (r *Request) Legacy() bool {
+	var addr, ok = r.Src.(*net.UDPAddr)
+	return ok && addr.Port != r.serverPort()
+}
+
+func (r *Request) serverPort() int {
+	if r.port == 0 {
+		return Port
+	}
+	return r.port
+}
+
+// ResponseWriter collects the records of the response to a Request.
+type ResponseWriter interface {
+	// Answer adds records to the answer section. Records the querier listed
+	// as known answers with at least half of their TTL left are left out
+	// (RFC 6762 §7.1).
+	Answer(records ...dnsmessage.Resource)
+
+	// Authority adds records to the authority section.
+	Authority(records ...dnsmessage.Resource)
+
+	// Additional adds records to the additional section.
+	Additional(records ...dnsmessage.Resource)
+
+	// Unicast reports whether the response will be sent directly to the
+	// querier instead of being multicast.
+	Unicast() bool
+}
+
+// Serve answers the queries received by server with handler. Responses to
+// legacy unicast queries and to questions with the QU bit set are sent to the
+// querier; all others are multicast.
+//
+// Serve registers an OnMessage handler on server, replacing any registered
+// before.
+func Serve(server Server, handler Handler) {
+	server.OnMessage(func(src net.Addr, message Message) {
+		serveMessage(server, handler, src, message)
+	})
+}
+
+// messageSender is implemented by the servers of this package, which can send
+// the question section that responses to legacy unicast queries repeat.
+type messageSender interface {
+	sendMessage(message dnsmessage.Message, dst *net.UDPAddr) error
+}
+
+// porter is implemented by the servers of this package, which may listen on
+// another port than Port.
+type porter interface {
+	localPort() int
+}
+
+// warner is implemented by the servers of this package to report send errors
+// through OnWarning.
+type warner interface {
+	warn(addr net.Addr, err error)
+}
+
+func serveMessage(server Server, handler Handler, src net.Addr, message Message) {
+	if message.Header.Response || len(message.Questions) == 0 {
+		return
+	}
+
+	var unicast, multicast response
+	var addr, _ = src.(*net.UDPAddr)
+	var port = Port
+	if p, ok := server.(porter); ok {
+		port = p.localPort()
+	}
+
+	for _, question := range message.Questions {
+		var nRequest = &Request{Question: question, Message: message, Src: src, port: port}
+		var w = &responseWriter{response: &multicast, known: message.Answers}
+		if addr != nil && (nRequest.Legacy() || nRequest.Unicast()) {
+			w.response = &unicast
+			w.unicast = true
+		}
+		handler.ServeMDNS(w, nRequest)
+	}
+
+	var err error
+	if !unicast.empty() {
+		if addr.Port != port {
+			err = sendLegacy(server, unicast, message, addr)
+		} else {
+			err = server.SendTo(unicast.resource(), addr)
+		}
+	}
+	if !multicast.empty() {
+		if mErr := server.Multicast(multicast.resource()); err == nil {
+			err = mErr
+		}
+	}
+	if w, ok := server.(warner); ok && err != nil {
+		w.warn(src, err)
+	}
+}
+
+// sendLegacy sends a response to a legacy unicast query: it carries the ID
+// and the questions of the query and TTLs of at most ten seconds.
+func sendLegacy(server Server, nResponse response, query Message, dst *net.UDPAddr) error {
+	var nResource = nResponse.resource()
+	nResource.Header.ID = query.Header.ID
+	for _, section := range [][]dnsmessage.Resource{nResource.Answers, nResource.Authorities, nResource.Additionals} {
+		for i := range section {
+			section[i].Header.Class &^= cacheFlushBit
+			if section[i].Header.TTL > legacyTTL {
+				section[i].Header.TTL = legacyTTL
+			}
+		}
+	}
+
+	var sender, ok = server.(messageSender)
+	if !ok {
+		return server.SendTo(nResource, dst)
+	}
+
+	var questions = make([]dnsmessage.Question, 0, len(query.Questions))
+	for _, question := range query.Questions {
+		question.Class &^= unicastResponseBit
+		questions = append(questions, question)
+	}
+	return sender.sendMessage(dnsmessage.Message{
+		Header:      nResource.Header,
+		Questions:   questions,
+		Answers:     nResource.Answers,
+		Authorities: nResource.Authorities,
+		Additionals: nResource.Additionals,
+	}, dst)
+}
+
+// response accumulates the records added by the handlers of one query,
+// without duplicates.
+type response struct {
+	answers     []dnsmessage.Resource
+	authorities []dnsmessage.Resource
+	additionals []dnsmessage.Resource
+	seen        map[string]struct{}
+}
+
+func (r *response) add(section *[]dnsmessage.Resource, record dnsmessage.Resource) {
+	if r.seen == nil {
+		r.seen = make(map[string]struct{})
+	}
+	var key = cacheKey(record)
+	if _, ok := r.seen[key]; ok {
+		return
+	}
+	r.seen[key] = struct{}{}
+	*section = append(*section, record)
+}
+
+func (r *response) empty() bool {
+	return len(r.answers) == 0 && len(r.authorities) == 0 && len(r.additionals) == 0
+}
+
+func (r *response) resource() Resource {
+	return Resource{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     r.answers,
+		Authorities: r.authorities,
+		Additionals: r.additionals,
+	}
+}
+
+type responseWriter struct {
+	response *response
+	known    []dnsmessage.Resource
+	unicast  bool
+}
+
+func (w *responseWriter) Answer(records ...dnsmessage.Resource) {
+	for _, record := range records {
+		if !w.isKnown(record) {
+			w.response.add(&w.response.answers, record)
+		}
+	}
+}
+
+func (w *responseWriter) Authority(records ...dnsmessage.Resource) {
+	for _, record := range records {
+		w.response.add(&w.response.authorities, record)
+	}
+}
+
+func (w *responseWriter) Additional(records ...dnsmessage.Resource) {
+	for _, record := range records {
+		w.response.add(&w.response.additionals, record)
+	}
+}
+
+func (w *responseWriter) Unicast() bool {
+	return w.unicast
+}
+
+// isKnown reports whether the querier listed record as a known answer with at
+// least half of its TTL left.
+func (w *responseWriter) isKnown(record dnsmessage.Resource) bool {
+	var key = cacheKey(record)
+	for _, known := range w.known {
+		if known.Header.TTL >= record.Header.TTL/2 && cacheKey(known) == key {
+			return true
+		}
+	}
+	return false
+}
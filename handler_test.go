@@ -0,0 +1,254 @@
+package mdns_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smartwalle/mdns"
+	"github.com/smartwalle/mdns/mdnstest"
+	"github.com/smartwalle/mdns/memnet"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	qu         = 1 << 15
+	cacheFlush = 1 << 15
+)
+
+func TestServeMuxHandlers(t *testing.T) {
+	var mux = mdns.NewServeMux()
+	var register = func(pattern string, typ dnsmessage.Type, label string) {
+		mux.HandleFunc(pattern, typ, func(w mdns.ResponseWriter, r *mdns.Request) {
+			w.Additional(dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(label + ".label."), Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.TXTResource{TXT: []string{label}},
+			})
+		})
+	}
+	register("printer._ipp._tcp.local.", dnsmessage.TypeSRV, "exact-srv")
+	register("printer._ipp._tcp.local.", dnsmessage.TypeALL, "exact-all")
+	register("*._ipp._tcp.local.", dnsmessage.TypeSRV, "ipp-srv")
+	register("*._tcp.local.", dnsmessage.TypeSRV, "tcp-srv")
+	register("*._tcp.local.", dnsmessage.TypeTXT, "tcp-txt")
+
+	var tests = []struct {
+		name  string
+		qName string
+		qType dnsmessage.Type
+		class dnsmessage.Class
+		want  []string
+	}{
+		{"exact name and type", "printer._ipp._tcp.local.", dnsmessage.TypeSRV, dnsmessage.ClassINET, []string{"exact-srv"}},
+		{"exact name before wildcard", "printer._ipp._tcp.local.", dnsmessage.TypeTXT, dnsmessage.ClassINET, []string{"exact-all"}},
+		{"longer wildcard first", "scanner._ipp._tcp.local.", dnsmessage.TypeSRV, dnsmessage.ClassINET, []string{"ipp-srv"}},
+		{"shorter wildcard for other types", "scanner._ipp._tcp.local.", dnsmessage.TypeTXT, dnsmessage.ClassINET, []string{"tcp-txt"}},
+		{"shorter wildcard", "scanner._http._tcp.local.", dnsmessage.TypeTXT, dnsmessage.ClassINET, []string{"tcp-txt"}},
+		{"case and trailing dot", "Printer._IPP._tcp.local", dnsmessage.TypeSRV, dnsmessage.ClassINET, []string{"exact-srv"}},
+		{"type ANY", "printer._ipp._tcp.local.", dnsmessage.TypeALL, dnsmessage.ClassINET, []string{"exact-srv", "exact-all"}},
+		{"type ANY on wildcard", "scanner._http._tcp.local.", dnsmessage.TypeALL, dnsmessage.ClassINET, []string{"tcp-srv", "tcp-txt"}},
+		{"class ANY", "printer._ipp._tcp.local.", dnsmessage.TypeSRV, dnsmessage.ClassANY, []string{"exact-srv"}},
+		{"wildcard needs a label", "_tcp.local.", dnsmessage.TypeSRV, dnsmessage.ClassINET, nil},
+		{"no pattern", "printer.local.", dnsmessage.TypeA, dnsmessage.ClassINET, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var server = mdnstest.NewFakeServer()
+			mdns.Serve(server, mux)
+			server.ReceiveQuestion(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: mdns.Port}, mdns.Question{
+				Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(tt.qName), Type: tt.qType, Class: tt.class}},
+			})
+
+			var got []string
+			for _, resource := range server.Resources() {
+				for _, record := range resource.Additionals {
+					got = append(got, record.Body.(*dnsmessage.TXTResource).TXT[0])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("served by %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeResponse(t *testing.T) {
+	var name = dnsmessage.MustNewName("printer.local.")
+	var record = func(ttl uint32) dnsmessage.Resource {
+		return dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		}
+	}
+	var mux = mdns.NewServeMux()
+	mux.HandleFunc(name.String(), dnsmessage.TypeA, func(w mdns.ResponseWriter, r *mdns.Request) {
+		w.Answer(record(120))
+	})
+
+	var mDNSPeer = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: mdns.Port}
+	var resolver = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 49152}
+	var tests = []struct {
+		name     string
+		src      *net.UDPAddr
+		message  mdns.Message
+		want     bool
+		wantDst  *net.UDPAddr
+		wantID   uint16
+		wantTTL  uint32
+		wantFlag dnsmessage.Class
+	}{
+		{
+			name:     "multicast",
+			src:      mDNSPeer,
+			message:  mdns.Message{Header: dnsmessage.Header{ID: 42}},
+			want:     true,
+			wantTTL:  120,
+			wantFlag: cacheFlush,
+		},
+		{
+			name:     "QU",
+			src:      mDNSPeer,
+			message:  mdns.Message{Header: dnsmessage.Header{ID: 42}, Questions: []dnsmessage.Question{{Class: dnsmessage.ClassINET | qu}}},
+			want:     true,
+			wantDst:  mDNSPeer,
+			wantTTL:  120,
+			wantFlag: cacheFlush,
+		},
+		{
+			name:    "legacy",
+			src:     resolver,
+			message: mdns.Message{Header: dnsmessage.Header{ID: 42}},
+			want:    true,
+			wantDst: resolver,
+			wantID:  42,
+			wantTTL: 10,
+		},
+		{
+			name:    "legacy QU",
+			src:     resolver,
+			message: mdns.Message{Header: dnsmessage.Header{ID: 42}, Questions: []dnsmessage.Question{{Class: dnsmessage.ClassINET | qu}}},
+			want:    true,
+			wantDst: resolver,
+			wantID:  42,
+			wantTTL: 10,
+		},
+		{
+			name:    "known answer",
+			src:     mDNSPeer,
+			message: mdns.Message{Answers: []dnsmessage.Resource{record(60)}},
+		},
+		{
+			name:     "stale known answer",
+			src:      mDNSPeer,
+			message:  mdns.Message{Answers: []dnsmessage.Resource{record(59)}},
+			want:     true,
+			wantTTL:  120,
+			wantFlag: cacheFlush,
+		},
+		{
+			name:    "response",
+			src:     mDNSPeer,
+			message: mdns.Message{Header: dnsmessage.Header{Response: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var server = mdnstest.NewFakeServer()
+			mdns.Serve(server, mux)
+			var message = tt.message
+			if len(message.Questions) == 0 {
+				message.Questions = []dnsmessage.Question{{Class: dnsmessage.ClassINET}}
+			}
+			message.Questions[0].Name = name
+			message.Questions[0].Type = dnsmessage.TypeA
+			server.ReceiveMessage(tt.src, message)
+
+			var sent = server.Sent()
+			if !tt.want {
+				if len(sent) != 0 {
+					t.Fatalf("sent %+v, want nothing", sent)
+				}
+				return
+			}
+			if len(sent) != 1 || len(sent[0].Resource.Answers) != 1 {
+				t.Fatalf("sent %+v, want one answer", sent)
+			}
+			if !reflect.DeepEqual(sent[0].Dst, tt.wantDst) {
+				t.Errorf("sent to %v, want %v", sent[0].Dst, tt.wantDst)
+			}
+			var header = sent[0].Resource.Answers[0].Header
+			if id := sent[0].Resource.Header.ID; id != tt.wantID {
+				t.Errorf("ID %d, want %d", id, tt.wantID)
+			}
+			if header.TTL != tt.wantTTL || header.Class&cacheFlush != tt.wantFlag {
+				t.Errorf("TTL %d and class %#x, want %d and cache flush %#x", header.TTL, header.Class, tt.wantTTL, tt.wantFlag)
+			}
+		})
+	}
+}
+
+func TestServeLegacyEchoesQuestions(t *testing.T) {
+	var network = memnet.NewNetwork()
+	var lan = network.NewLink("lan")
+	var serverHost = network.NewHost("server")
+	serverHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 1))
+	var resolverHost = network.NewHost("resolver")
+	resolverHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 2))
+
+	var name = dnsmessage.MustNewName("printer.local.")
+	var mux = mdns.NewServeMux()
+	mux.HandleFunc(name.String(), dnsmessage.TypeA, func(w mdns.ResponseWriter, r *mdns.Request) {
+		w.Answer(dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET | cacheFlush, TTL: 120},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		})
+	})
+
+	var server = mdns.NewServer(mdns.WithTransport(serverHost))
+	server.EnableIPv4()
+	mdns.Serve(server, mux)
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop(context.Background())
+
+	var conn, err = resolverHost.ListenPacket("udp4", &net.UDPAddr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var questions = []dnsmessage.Question{
+		{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET | qu},
+		{Name: dnsmessage.MustNewName("scanner.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+	}
+	var query = dnsmessage.Message{Header: dnsmessage.Header{ID: 42}, Questions: questions}
+	b, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.WriteTo(b, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: mdns.Port}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var reply = make([]byte, 9000)
+	n, _, err := conn.ReadFrom(reply)
+	if err != nil {
+		t.Fatalf("no reply: %v", err)
+	}
+	var message dnsmessage.Message
+	if err = message.Unpack(reply[:n]); err != nil {
+		t.Fatal(err)
+	}
+
+	questions[0].Class = dnsmessage.ClassINET
+	if message.Header.ID != 42 || !reflect.DeepEqual(message.Questions, questions) {
+		t.Fatalf("reply has ID %d and questions %v, want 42 and %v", message.Header.ID, message.Questions, questions)
+	}
+	if len(message.Answers) != 1 || message.Answers[0].Header.TTL != 10 || message.Answers[0].Header.Class != dnsmessage.ClassINET {
+		t.Fatalf("reply answers %v, want one with TTL 10 without cache flush", message.Answers)
+	}
+}
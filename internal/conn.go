@@ -3,6 +3,7 @@ package internal
 import (
 	"fmt"
 	"net"
+	"sync"
 )
 
 type PacketConnFactory interface {
@@ -21,6 +22,7 @@ func NewConn(mAddr, lAddr, rAddr *net.UDPAddr, lFactory, rFactory PacketConnFact
 }
 
 type Conn struct {
+	mu       sync.Mutex
 	mAddr    *net.UDPAddr
 	lAddr    *net.UDPAddr
 	rAddr    *net.UDPAddr
@@ -28,30 +30,27 @@ type Conn struct {
 	rFactory PacketConnFactory
 	lConn    net.PacketConn
 	rConn    net.PacketConn
+	ifaces   []net.Interface
 	ttl      int
+	closed   bool
 }
 
 func (c *Conn) SetMulticastTTL(ttl int) error {
 	if ttl > 255 {
-		return fmt.Errorf("TTL outside of valid range: %d", ttl)
+		return fmt.Errorf("%w: %d", ErrInvalidTTL, ttl)
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.ttl = ttl
 	return nil
 }
 
-func (c *Conn) SetPort(mPort, lPort, rPort int) {
-	if c.mAddr != nil {
-		c.mAddr.Port = mPort
-	}
-	if c.lAddr != nil {
-		c.lAddr.Port = lPort
-	}
-	if c.rAddr != nil {
-		c.rAddr.Port = rPort
-	}
-}
-
 func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
 	var lerr error
 	if c.lConn != nil {
 		lerr = c.lConn.Close()
@@ -69,62 +68,123 @@ func (c *Conn) Close() error {
 	return rerr
 }
 
-func (c *Conn) Listen(packets chan Packet, quit chan struct{}) {
-	go c.listen(c.lConn, packets, quit)
-
-	if c.rConn != nil {
-		go c.listen(c.rConn, packets, quit)
+// Listen starts a goroutine reading from every open socket, adding them to wg.
+// If sup is not nil, sockets failing with a read error are re-created as it
+// configures; otherwise the error is sent to packets and the goroutine exits.
+func (c *Conn) Listen(packets chan Packet, quit chan struct{}, wg *sync.WaitGroup, sup *Supervisor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, socket := range []struct {
+		conn   net.PacketConn
+		remote bool
+	}{{c.lConn, false}, {c.rConn, true}} {
+		if socket.conn == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(conn net.PacketConn, remote bool) {
+			defer wg.Done()
+			c.listen(conn, remote, packets, quit, sup)
+		}(socket.conn, socket.remote)
 	}
 }
 
-func (c *Conn) listen(conn net.PacketConn, packets chan Packet, quit chan struct{}) {
-	var payload = make([]byte, 1<<16)
+func (c *Conn) listen(conn net.PacketConn, remote bool, packets chan Packet, quit chan struct{}, sup *Supervisor) {
 	for {
-		n, src, err := conn.ReadFrom(payload)
-		if err != nil {
+		var err = c.read(conn, packets, quit)
+		if err == nil || c.isClosed() {
+			return
+		}
+
+		if sup == nil {
 			select {
 			case <-quit:
 			case packets <- Packet{Error: err}:
 			}
 			return
 		}
+
+		if transient(err) {
+			if !sup.transient(c.addr(remote), err, quit) {
+				return
+			}
+			continue
+		}
+
+		if conn, err = c.recover(remote, err, quit, sup); err != nil {
+			select {
+			case <-quit:
+			case packets <- Packet{Error: err}:
+			}
+			return
+		}
+		if conn == nil {
+			return
+		}
+	}
+}
+
+// read reads from conn into packets until a read fails, returning the error,
+// or until quit is closed, returning nil.
+func (c *Conn) read(conn net.PacketConn, packets chan Packet, quit chan struct{}) error {
+	if reader, ok := conn.(batchReader); ok {
+		return c.readBatch(reader, packets, quit)
+	}
+
+	var buf = make([]byte, maxPacketSize)
+	for {
+		n, src, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		var nPacket = newPacket(buf[:n], src)
 		select {
 		case <-quit:
-		case packets <- Packet{Data: append([]byte(nil), payload[:n]...), Addr: src}:
+			nPacket.Release()
+			return nil
+		case packets <- nPacket:
 		}
 	}
 }
 
 func (c *Conn) SendTo(b []byte, dst *net.UDPAddr) error {
-	_, err := c.lConn.WriteTo(b, dst)
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.SendBatch([][]byte{b}, dst, false)
 }
 
 func (c *Conn) Multicast(b []byte) error {
 	return c.SendTo(b, c.mAddr)
 }
 
+// MakeUDPSocket creates the sockets of c. The factories are called without
+// holding c.mu, so that their callbacks may use c.
 func (c *Conn) MakeUDPSocket(ifaces []net.Interface) (err error) {
+	c.mu.Lock()
+	var lAddr, rAddr, ttl = c.lAddr, c.rAddr, c.ttl
+	c.mu.Unlock()
+
 	var lConn net.PacketConn
 	var rConn net.PacketConn
 
-	lConn, err = c.lFactory.MakeUDPSocket(ifaces, c.lAddr, c.ttl)
+	lConn, err = c.lFactory.MakeUDPSocket(ifaces, lAddr, ttl)
 	if err != nil {
 		return err
 	}
 
-	if c.rFactory != nil && c.rAddr != nil {
-		rConn, err = c.rFactory.MakeUDPSocket(ifaces, c.rAddr, c.ttl)
+	if c.rFactory != nil && rAddr != nil {
+		rConn, err = c.rFactory.MakeUDPSocket(ifaces, rAddr, ttl)
 		if err != nil {
 			_ = lConn.Close()
 			return err
 		}
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.lConn = lConn
 	c.rConn = rConn
+	c.ifaces = multicastInterfaces(ifaces)
+	c.closed = false
 	return nil
 }
@@ -1,13 +1,17 @@
 package internal
 
 import (
-	"fmt"
 	"golang.org/x/net/ipv4"
 	"net"
 )
 
 type ipv4PacketConn struct {
 	*ipv4.PacketConn
+	conn *net.UDPConn
+}
+
+func newIPv4PacketConn(conn *net.UDPConn) *ipv4PacketConn {
+	return &ipv4PacketConn{PacketConn: ipv4.NewPacketConn(conn), conn: conn}
 }
 
 func (c *ipv4PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
@@ -19,39 +23,28 @@ func (c *ipv4PacketConn) WriteTo(b []byte, dst net.Addr) (int, error) {
 	return c.PacketConn.WriteTo(b, nil, dst)
 }
 
-type IPv4PacketConnFactory struct {
-	Group *net.UDPAddr
+func (c *ipv4PacketConn) SetReadBuffer(bytes int) error {
+	return c.conn.SetReadBuffer(bytes)
 }
 
-func (f *IPv4PacketConnFactory) MakeUDPSocket(ifaces []net.Interface, addr *net.UDPAddr, ttl int) (net.PacketConn, error) {
-	conn, err := net.ListenUDP("udp4", addr)
-	if err != nil {
-		return nil, err
-	}
-
-	pConn := ipv4.NewPacketConn(conn)
-	if ttl >= 0 {
-		if err := pConn.SetMulticastTTL(ttl); err != nil {
-			pConn.Close()
-			return nil, err
-		}
-	}
+func (c *ipv4PacketConn) interfaceControl(index int) []byte {
+	return (&ipv4.ControlMessage{IfIndex: index}).Marshal()
+}
 
-	if f.Group != nil {
-		pConn.SetMulticastLoopback(true)
+const ipv4ControlFlags = ipv4.FlagTTL | ipv4.FlagInterface
 
-		var errCount = 0
+func (c *ipv4PacketConn) setControl(on bool) error {
+	return c.PacketConn.SetControlMessage(ipv4ControlFlags, on)
+}
 
-		for i := range ifaces {
-			if nErr := pConn.JoinGroup(&ifaces[i], f.Group); nErr != nil {
-				errCount += 1
-			}
-		}
+func (c *ipv4PacketConn) newControlBuffer() []byte {
+	return ipv4.NewControlMessage(ipv4ControlFlags)
+}
 
-		if errCount == len(ifaces) {
-			pConn.Close()
-			return nil, fmt.Errorf("failed to join multicast group on all interfaces")
-		}
+func (c *ipv4PacketConn) parseControl(oob []byte) (int, int) {
+	var cm ipv4.ControlMessage
+	if err := cm.Parse(oob); err != nil {
+		return 0, 0
 	}
-	return &ipv4PacketConn{PacketConn: pConn}, nil
+	return cm.TTL, cm.IfIndex
 }
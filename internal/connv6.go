@@ -1,13 +1,17 @@
 package internal
 
 import (
-	"fmt"
 	"golang.org/x/net/ipv6"
 	"net"
 )
 
 type ipv6PacketConn struct {
 	*ipv6.PacketConn
+	conn *net.UDPConn
+}
+
+func newIPv6PacketConn(conn *net.UDPConn) *ipv6PacketConn {
+	return &ipv6PacketConn{PacketConn: ipv6.NewPacketConn(conn), conn: conn}
 }
 
 func (c *ipv6PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
@@ -19,39 +23,37 @@ func (c *ipv6PacketConn) WriteTo(b []byte, dst net.Addr) (int, error) {
 	return c.PacketConn.WriteTo(b, nil, dst)
 }
 
-type IPv6PacketConnFactory struct {
-	Group *net.UDPAddr
+func (c *ipv6PacketConn) SetMulticastTTL(ttl int) error {
+	return c.PacketConn.SetMulticastHopLimit(ttl)
 }
 
-func (f *IPv6PacketConnFactory) MakeUDPSocket(ifaces []net.Interface, addr *net.UDPAddr, ttl int) (net.PacketConn, error) {
-	conn, err := net.ListenUDP("udp6", addr)
-	if err != nil {
-		return nil, err
-	}
+// SetTTL sets the hop limit of unicast packets.
+func (c *ipv6PacketConn) SetTTL(ttl int) error {
+	return c.PacketConn.SetHopLimit(ttl)
+}
 
-	pConn := ipv6.NewPacketConn(conn)
-	if ttl >= 0 {
-		if err := pConn.SetMulticastHopLimit(ttl); err != nil {
-			pConn.Close()
-			return nil, err
-		}
-	}
+func (c *ipv6PacketConn) SetReadBuffer(bytes int) error {
+	return c.conn.SetReadBuffer(bytes)
+}
 
-	if f.Group != nil {
-		pConn.SetMulticastLoopback(true)
+func (c *ipv6PacketConn) interfaceControl(index int) []byte {
+	return (&ipv6.ControlMessage{IfIndex: index}).Marshal()
+}
 
-		var errCount = 0
+const ipv6ControlFlags = ipv6.FlagHopLimit | ipv6.FlagInterface
 
-		for i := range ifaces {
-			if nErr := pConn.JoinGroup(&ifaces[i], f.Group); nErr != nil {
-				errCount += 1
-			}
-		}
+func (c *ipv6PacketConn) setControl(on bool) error {
+	return c.PacketConn.SetControlMessage(ipv6ControlFlags, on)
+}
+
+func (c *ipv6PacketConn) newControlBuffer() []byte {
+	return ipv6.NewControlMessage(ipv6ControlFlags)
+}
 
-		if errCount == len(ifaces) {
-			pConn.Close()
-			return nil, fmt.Errorf("failed to join multicast group on all interfaces")
-		}
+func (c *ipv6PacketConn) parseControl(oob []byte) (int, int) {
+	var cm ipv6.ControlMessage
+	if err := cm.Parse(oob); err != nil {
+		return 0, 0
 	}
-	return &ipv6PacketConn{PacketConn: pConn}, nil
+	return cm.HopLimit, cm.IfIndex
 }
@@ -0,0 +1,16 @@
+package internal
+
+// controlConn is implemented by the sockets of UDPTransport, which can report
+// the IP TTL or hop limit of received packets and the interface they arrived
+// on.
+type controlConn interface {
+	setControl(on bool) error
+
+	// newControlBuffer returns a buffer large enough for the control
+	// messages enabled by setControl.
+	newControlBuffer() []byte
+
+	// parseControl returns the hop limit and interface index found in oob,
+	// or zeros.
+	parseControl(oob []byte) (hopLimit, ifIndex int)
+}
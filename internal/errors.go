@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+var (
+	// ErrNotStarted is returned when sending on a Conn whose sockets are not
+	// open.
+	ErrNotStarted = errors.New("connection not started")
+
+	// ErrInvalidTTL is returned for a multicast TTL above 255.
+	ErrInvalidTTL = errors.New("TTL outside of valid range")
+)
+
+// JoinGroupError is returned when a socket could not join its multicast group
+// on every interface, or on any interface when the join is strict.
+type JoinGroupError struct {
+	Group net.Addr
+
+	// Interfaces is the number of interfaces the group was joined on, or
+	// tried to be.
+	Interfaces int
+
+	// Failures holds the error of every interface that could not join.
+	Failures []*JoinError
+}
+
+func (e *JoinGroupError) Error() string {
+	if len(e.Failures) == e.Interfaces {
+		return fmt.Sprintf("failed to join multicast group %s on all interfaces", e.Group)
+	}
+	return fmt.Sprintf("failed to join multicast group %s on %d of %d interfaces: %v", e.Group, len(e.Failures), e.Interfaces, e.Failures[0])
+}
+
+// Unwrap returns the errors of the failed interfaces.
+func (e *JoinGroupError) Unwrap() []error {
+	var errs = make([]error, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		errs = append(errs, failure)
+	}
+	return errs
+}
+
+// FailedInterfaces returns the interfaces that could not join the group.
+func (e *JoinGroupError) FailedInterfaces() []net.Interface {
+	var ifaces = make([]net.Interface, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		ifaces = append(ifaces, failure.Interface)
+	}
+	return ifaces
+}
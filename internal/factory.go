@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"net"
+)
+
+// SocketFactory creates sockets through a Transport and optionally joins them
+// to a multicast group.
+type SocketFactory struct {
+	// Network is either "udp4" or "udp6".
+	Network string
+
+	// Transport creates the sockets. If nil, UDPTransport is used.
+	Transport Transport
+
+	Group *net.UDPAddr
+
+	// Loopback controls whether multicast packets sent by the socket are
+	// looped back to the local host.
+	Loopback bool
+
+	// ReadBuffer sets the size of the socket receive buffer if greater than zero.
+	ReadBuffer int
+
+	// Strict makes MakeUDPSocket fail if any interface cannot join Group.
+	Strict bool
+
+	// Control makes the socket report the hop limit and the receiving
+	// interface of packets, if the transport supports it.
+	Control bool
+
+	// OnJoinError is called for every interface that cannot join Group.
+	OnJoinError func(err *JoinError)
+
+	// OnJoin is called for every interface that joined Group.
+	OnJoin func(iface *net.Interface, group net.Addr)
+
+	// OnOpen is called with the local address of every socket created.
+	OnOpen func(network string, addr net.Addr)
+}
+
+// unicastTTL is the IP TTL (IPv4) and hop limit (IPv6) of unicast packets.
+const unicastTTL = 255
+
+// unicastTTLSetter is implemented by the sockets of UDPTransport.
+type unicastTTLSetter interface {
+	SetTTL(ttl int) error
+}
+
+func (f *SocketFactory) MakeUDPSocket(ifaces []net.Interface, addr *net.UDPAddr, ttl int) (net.PacketConn, error) {
+	var transport = f.Transport
+	if transport == nil {
+		transport = UDPTransport{}
+	}
+
+	pConn, err := transport.ListenPacket(f.Network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.ReadBuffer > 0 {
+		if err := pConn.SetReadBuffer(f.ReadBuffer); err != nil {
+			pConn.Close()
+			return nil, err
+		}
+	}
+
+	if ttl >= 0 {
+		if err := pConn.SetMulticastTTL(ttl); err != nil {
+			pConn.Close()
+			return nil, err
+		}
+	}
+
+	if setter, ok := pConn.(unicastTTLSetter); ok {
+		// Unicast responses are sent with a TTL of 255 too (RFC 6762 §11).
+		// Platforms that cannot set it keep their default.
+		_ = setter.SetTTL(unicastTTL)
+	}
+
+	if err := pConn.SetMulticastLoopback(f.Loopback); err != nil {
+		pConn.Close()
+		return nil, err
+	}
+
+	if control, ok := pConn.(controlConn); ok && f.Control {
+		// Platforms without control messages leave the packet metadata
+		// unknown rather than failing.
+		_ = control.setControl(true)
+	}
+
+	if f.Group != nil {
+		if err := joinGroup(pConn.JoinGroup, ifaces, f.Group, f.Strict, f.OnJoin, f.OnJoinError); err != nil {
+			pConn.Close()
+			return nil, err
+		}
+	}
+
+	if f.OnOpen != nil {
+		f.OnOpen(f.Network, pConn.LocalAddr())
+	}
+	return pConn, nil
+}
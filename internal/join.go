@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+)
+
+// JoinError records a failure to join a multicast group on a single interface.
+type JoinError struct {
+	Interface net.Interface
+	Group     net.Addr
+	Err       error
+}
+
+func (e *JoinError) Error() string {
+	return fmt.Sprintf("join %s on %s: %v", e.Group, e.Interface.Name, e.Err)
+}
+
+func (e *JoinError) Unwrap() error {
+	return e.Err
+}
+
+// joinGroup joins group on every interface in ifaces, reporting each success
+// through joined and each failure through report. It fails if no interface
+// could join, or if strict is set and any interface could not join.
+func joinGroup(join func(*net.Interface, net.Addr) error, ifaces []net.Interface, group net.Addr, strict bool,
+	joined func(*net.Interface, net.Addr), report func(*JoinError)) error {
+	var failures []*JoinError
+	for i := range ifaces {
+		if err := join(&ifaces[i], group); err != nil {
+			var jErr = &JoinError{Interface: ifaces[i], Group: group, Err: err}
+			failures = append(failures, jErr)
+			if report != nil {
+				report(jErr)
+			}
+		} else if joined != nil {
+			joined(&ifaces[i], group)
+		}
+	}
+
+	if len(failures) == len(ifaces) || (strict && len(failures) > 0) {
+		return &JoinGroupError{Group: group, Interfaces: len(ifaces), Failures: failures}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package internal
+
+import (
+	"context"
+	"net"
+)
+
+// listenUDP binds a UDP socket to addr with address and port reuse enabled, so
+// that it can share the mDNS port with system responders and other processes.
+func listenUDP(network string, addr *net.UDPAddr) (*net.UDPConn, error) {
+	var lc = net.ListenConfig{Control: reuseControl}
+	conn, err := lc.ListenPacket(context.Background(), network, addr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
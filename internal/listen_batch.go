@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"golang.org/x/net/ipv4"
+)
+
+// batchSize is the number of packets read at once by sockets supporting
+// ReadBatch.
+const batchSize = 8
+
+// batchReader is implemented by the sockets of UDPTransport. ipv4.Message and
+// ipv6.Message are the same type, so both families share it. On Linux
+// ReadBatch uses recvmmsg; elsewhere it reads one packet per call.
+type batchReader interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// readBatch reads from reader into packets until a read fails, returning the
+// error, or until quit is closed, returning nil.
+func (c *Conn) readBatch(reader batchReader, packets chan Packet, quit chan struct{}) error {
+	var control, _ = reader.(controlConn)
+	var ms = make([]ipv4.Message, batchSize)
+	for i := range ms {
+		ms[i].Buffers = [][]byte{make([]byte, maxPacketSize)}
+		if control != nil {
+			ms[i].OOB = control.newControlBuffer()
+		}
+	}
+
+	for {
+		n, err := reader.ReadBatch(ms, 0)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < n; i++ {
+			var nPacket = newPacket(ms[i].Buffers[0][:ms[i].N], ms[i].Addr)
+			if control != nil && ms[i].NN > 0 {
+				nPacket.HopLimit, nPacket.IfIndex = control.parseControl(ms[i].OOB[:ms[i].NN])
+			}
+
+			select {
+			case <-quit:
+				nPacket.Release()
+				return nil
+			case packets <- nPacket:
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"golang.org/x/net/ipv4"
+)
+
+var benchAddr = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5353}
+
+// fakeReader returns packets of size bytes for as long as it is read.
+type fakeReader struct {
+	net.PacketConn
+	size int
+}
+
+func (r *fakeReader) ReadBatch(ms []ipv4.Message, flags int) (int, error) {
+	for i := range ms {
+		ms[i].N = r.size
+		ms[i].Addr = benchAddr
+	}
+	return len(ms), nil
+}
+
+func (r *fakeReader) ReadFrom(b []byte) (int, net.Addr, error) {
+	return r.size, benchAddr, nil
+}
+
+// plainReader hides the ReadBatch method of fakeReader.
+type plainReader struct {
+	net.PacketConn
+}
+
+// benchmarkRead reports the allocations per packet received and queued, and
+// the size of the buffer each queued packet holds until it is released.
+func benchmarkRead(b *testing.B, conn net.PacketConn) {
+	var c = &Conn{}
+	var packets = make(chan Packet, 64)
+	var quit = make(chan struct{})
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.read(conn, packets, quit)
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var held int
+	for i := 0; i < b.N; i++ {
+		var nPacket = <-packets
+		held += cap(*nPacket.buf)
+		nPacket.Release()
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(held)/float64(b.N), "held-B/packet")
+
+	close(quit)
+	for {
+		select {
+		case nPacket := <-packets:
+			nPacket.Release()
+			continue
+		case <-done:
+		}
+		break
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	for _, size := range []int{100, 1400, 9000} {
+		b.Run(fmt.Sprintf("batch/%d", size), func(b *testing.B) {
+			benchmarkRead(b, &fakeReader{size: size})
+		})
+		b.Run(fmt.Sprintf("plain/%d", size), func(b *testing.B) {
+			benchmarkRead(b, plainReader{&fakeReader{size: size}})
+		})
+	}
+}
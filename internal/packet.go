@@ -1,11 +1,87 @@
 package internal
 
-import "net"
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// maxPacketSize is the size of receive buffers, large enough for any UDP
+// payload.
+const maxPacketSize = 1 << 16
+
+// sizeClasses are the capacities of the buffers holding queued packets.
+// Packets are copied out of the receive buffers into the smallest class that
+// holds them, so that a queued packet of a few hundred bytes does not pin a
+// buffer sized for the largest UDP payload.
+var sizeClasses = [...]int{512, 1536, 9216, maxPacketSize}
+
+var bufferPools [len(sizeClasses)]sync.Pool
+
+// sizeClass returns the index of the smallest class holding n bytes.
+func sizeClass(n int) int {
+	for i, size := range sizeClasses {
+		if n <= size {
+			return i
+		}
+	}
+	return len(sizeClasses) - 1
+}
+
+// copyBuffer copies data into a pooled buffer of the smallest class that holds
+// it.
+func copyBuffer(data []byte) *[]byte {
+	var class = sizeClass(len(data))
+	var buf, _ = bufferPools[class].Get().(*[]byte)
+	if buf == nil {
+		var nBuf = make([]byte, sizeClasses[class])
+		buf = &nBuf
+	}
+	*buf = (*buf)[:copy((*buf)[:cap(*buf)], data)]
+	return buf
+}
+
+func putBuffer(buf *[]byte) {
+	var class = sizeClass(cap(*buf))
+	if cap(*buf) == sizeClasses[class] {
+		bufferPools[class].Put(buf)
+	}
+}
+
+// newPacket copies data out of a receive buffer into a Packet.
+func newPacket(data []byte, addr net.Addr) Packet {
+	var buf = copyBuffer(data)
+	return Packet{Data: *buf, Addr: addr, buf: buf}
+}
 
 // Packet A small struct used to send received UDP packets and
 // information about their interface / source address through a channel.
+//
+// Data points into a pooled buffer. Call Release once the packet has been
+// parsed; Data must not be used afterwards.
 type Packet struct {
 	Addr  net.Addr
 	Error error
 	Data  []byte
+	buf   *[]byte
+
+	// Time is when the packet was taken off the socket, set by the receiver.
+	Time time.Time
+	// HopLimit is the IP TTL (IPv4) or hop limit (IPv6) of the packet, and
+	// IfIndex the index of the interface it arrived on. Both are zero unless
+	// the socket was made with SocketFactory.Control.
+	HopLimit int
+	IfIndex  int
+
+	// Also holds the sources of the copies of the packet merged into it.
+	Also []net.Addr
+}
+
+// Release returns the buffer holding Data to the pool.
+func (p *Packet) Release() {
+	if p.buf != nil {
+		putBuffer(p.buf)
+		p.buf = nil
+		p.Data = nil
+	}
 }
@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+
+package internal
+
+import (
+	"syscall"
+)
+
+func reuseControl(network, address string, c syscall.RawConn) error {
+	return nil
+}
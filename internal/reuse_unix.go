@@ -0,0 +1,22 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package internal
+
+import (
+	"golang.org/x/sys/unix"
+	"syscall"
+)
+
+func reuseControl(network, address string, c syscall.RawConn) error {
+	var sErr error
+	err := c.Control(func(fd uintptr) {
+		if sErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); sErr != nil {
+			return
+		}
+		sErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sErr
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package internal
+
+import (
+	"syscall"
+)
+
+func reuseControl(network, address string, c syscall.RawConn) error {
+	var sErr error
+	err := c.Control(func(fd uintptr) {
+		sErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sErr
+}
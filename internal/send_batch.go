@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"golang.org/x/net/ipv4"
+	"io"
+	"net"
+)
+
+// batchWriter is implemented by the sockets of UDPTransport. On Linux
+// WriteBatch uses sendmmsg; elsewhere it sends one packet per call.
+type batchWriter interface {
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+
+	// interfaceControl returns the control message that sends a packet out
+	// of the interface with the given index.
+	interfaceControl(index int) []byte
+}
+
+// SendBatch sends every payload to dst. If perInterface is set and the
+// socket supports it, each payload is sent out of every multicast interface
+// instead of only the default one.
+func (c *Conn) SendBatch(payloads [][]byte, dst *net.UDPAddr, perInterface bool) error {
+	c.mu.Lock()
+	var lConn, ifaces = c.lConn, c.ifaces
+	c.mu.Unlock()
+
+	if lConn == nil {
+		return ErrNotStarted
+	}
+
+	var writer, ok = lConn.(batchWriter)
+	if !ok {
+		for _, payload := range payloads {
+			if _, err := lConn.WriteTo(payload, dst); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var controls = [][]byte{nil}
+	if perInterface && len(ifaces) > 0 {
+		controls = make([][]byte, 0, len(ifaces))
+		for _, iface := range ifaces {
+			controls = append(controls, writer.interfaceControl(iface.Index))
+		}
+	}
+
+	var ms = make([]ipv4.Message, 0, len(payloads)*len(controls))
+	for _, payload := range payloads {
+		for _, control := range controls {
+			ms = append(ms, ipv4.Message{Buffers: [][]byte{payload}, OOB: control, Addr: dst})
+		}
+	}
+
+	for len(ms) > 0 {
+		n, err := writer.WriteBatch(ms, 0)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		ms = ms[n:]
+	}
+	return nil
+}
+
+// MulticastBatch sends every payload to the multicast address.
+func (c *Conn) MulticastBatch(payloads [][]byte, perInterface bool) error {
+	return c.SendBatch(payloads, c.mAddr, perInterface)
+}
+
+// multicastInterfaces returns the interfaces of ifaces able to send multicast.
+func multicastInterfaces(ifaces []net.Interface) []net.Interface {
+	var result []net.Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 {
+			result = append(result, iface)
+		}
+	}
+	return result
+}
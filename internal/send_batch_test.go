@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"golang.org/x/net/ipv4"
+)
+
+// stuckWriter accepts no message and reports no error.
+type stuckWriter struct {
+	net.PacketConn
+}
+
+func (stuckWriter) WriteBatch(ms []ipv4.Message, flags int) (int, error) {
+	return 0, nil
+}
+
+func (stuckWriter) interfaceControl(index int) []byte {
+	return nil
+}
+
+func TestSendBatchShortWrite(t *testing.T) {
+	var c = &Conn{lConn: stuckWriter{}}
+	var err = c.SendBatch([][]byte{{0}}, benchAddr, false)
+	if !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("got %v, want io.ErrShortWrite", err)
+	}
+}
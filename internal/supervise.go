@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// RecoveryState tells what happened to a socket in a RecoveryEvent.
+type RecoveryState int
+
+const (
+	// RecoveryTransient is reported for a read error after which the socket
+	// keeps being read.
+	RecoveryTransient RecoveryState = iota
+
+	// RecoveryStarted is reported when a socket failed and is about to be
+	// re-created.
+	RecoveryStarted
+
+	// RecoveryFailed is reported for every failed attempt to re-create a
+	// socket.
+	RecoveryFailed
+
+	// RecoveryDone is reported once a socket has been re-created and has
+	// rejoined its multicast group.
+	RecoveryDone
+)
+
+func (s RecoveryState) String() string {
+	switch s {
+	case RecoveryTransient:
+		return "transient"
+	case RecoveryStarted:
+		return "started"
+	case RecoveryFailed:
+		return "failed"
+	case RecoveryDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// RecoveryEvent reports the recovery of a socket after a read error.
+type RecoveryEvent struct {
+	State RecoveryState
+
+	// Addr is the local address the socket is bound to.
+	Addr *net.UDPAddr
+
+	// Attempt counts the attempts to re-create the socket, from 1. It is zero
+	// for RecoveryTransient and RecoveryStarted.
+	Attempt int
+
+	// Err is the read error for RecoveryTransient and RecoveryStarted, and
+	// the error of the attempt for RecoveryFailed.
+	Err error
+}
+
+// Supervisor configures how Listen recovers from read errors.
+type Supervisor struct {
+	// Backoff returns how long to wait before the given attempt to re-create
+	// a socket, counting from 1. Backoff(1) is also the pause after a
+	// transient error.
+	Backoff func(attempt int) time.Duration
+
+	// MaxAttempts is the number of attempts after which recovery gives up
+	// and the error is sent to the packets channel. Zero means no limit.
+	MaxAttempts int
+
+	// After returns a channel that receives once d has passed.
+	After func(d time.Duration) <-chan time.Time
+
+	// Interfaces lists the interfaces on which a re-created socket rejoins
+	// its group.
+	Interfaces func() ([]net.Interface, error)
+
+	// OnEvent is called for every RecoveryEvent if not nil.
+	OnEvent func(RecoveryEvent)
+}
+
+func (s *Supervisor) event(event RecoveryEvent) {
+	if s.OnEvent != nil {
+		s.OnEvent(event)
+	}
+}
+
+// wait pauses before the given attempt and reports whether quit is still
+// open.
+func (s *Supervisor) wait(attempt int, quit chan struct{}) bool {
+	select {
+	case <-quit:
+		return false
+	case <-s.After(s.Backoff(attempt)):
+		return true
+	}
+}
+
+// transient reports a transient read error and pauses before the socket is
+// read again.
+func (s *Supervisor) transient(addr *net.UDPAddr, err error, quit chan struct{}) bool {
+	s.event(RecoveryEvent{State: RecoveryTransient, Addr: addr, Err: err})
+	return s.wait(1, quit)
+}
+
+// transient reports whether err leaves the socket usable, so that it can be
+// read again without being re-created.
+func transient(err error) bool {
+	var nErr net.Error
+	if errors.As(err, &nErr) && nErr.Timeout() {
+		return true
+	}
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// recover re-creates the failed socket, waiting before every attempt as sup
+// configures. It returns the new socket, or nil if c was closed or quit
+// closed meanwhile, or the error once sup gives up.
+func (c *Conn) recover(remote bool, cause error, quit chan struct{}, sup *Supervisor) (net.PacketConn, error) {
+	var addr = c.addr(remote)
+	sup.event(RecoveryEvent{State: RecoveryStarted, Addr: addr, Err: cause})
+
+	for attempt := 1; ; attempt++ {
+		if !sup.wait(attempt, quit) {
+			return nil, nil
+		}
+
+		var conn, err = c.remake(remote, sup.Interfaces)
+		if errors.Is(err, net.ErrClosed) {
+			return nil, nil
+		}
+		if err == nil {
+			sup.event(RecoveryEvent{State: RecoveryDone, Addr: addr, Attempt: attempt})
+			return conn, nil
+		}
+
+		sup.event(RecoveryEvent{State: RecoveryFailed, Addr: addr, Attempt: attempt, Err: err})
+		if sup.MaxAttempts > 0 && attempt >= sup.MaxAttempts {
+			return nil, fmt.Errorf("gave up re-creating socket %s after %d attempts: %w", addr, attempt, err)
+		}
+	}
+}
+
+// remake closes the local or remote socket of c and creates it again. It
+// returns net.ErrClosed if c was closed. The factory is called without
+// holding c.mu, so that its callbacks may send through c.
+func (c *Conn) remake(remote bool, interfaces func() ([]net.Interface, error)) (net.PacketConn, error) {
+	var ifaces, err = interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	var factory, addr, old = c.lFactory, c.lAddr, &c.lConn
+	if remote {
+		factory, addr, old = c.rFactory, c.rAddr, &c.rConn
+	}
+	if *old != nil {
+		_ = (*old).Close()
+		*old = nil
+	}
+	var ttl = c.ttl
+	c.mu.Unlock()
+
+	conn, err := factory.MakeUDPSocket(ifaces, addr, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		_ = conn.Close()
+		return nil, net.ErrClosed
+	}
+	*old = conn
+	if !remote {
+		c.ifaces = multicastInterfaces(ifaces)
+	}
+	return conn, nil
+}
+
+func (c *Conn) addr(remote bool) *net.UDPAddr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if remote {
+		return c.rAddr
+	}
+	return c.lAddr
+}
+
+func (c *Conn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
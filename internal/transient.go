@@ -0,0 +1,17 @@
+//go:build !plan9
+
+package internal
+
+import (
+	"syscall"
+)
+
+// transientErrnos are the read errors after which a socket is still usable.
+var transientErrnos = []error{
+	syscall.EINTR,
+	syscall.EAGAIN,
+	syscall.ENOBUFS,
+	syscall.ENOMEM,
+	syscall.ECONNREFUSED,
+	syscall.EMSGSIZE,
+}
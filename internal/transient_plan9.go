@@ -0,0 +1,10 @@
+package internal
+
+import (
+	"syscall"
+)
+
+// transientErrnos are the read errors after which a socket is still usable.
+var transientErrnos = []error{
+	syscall.EINTR,
+}
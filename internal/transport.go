@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"net"
+)
+
+// PacketConn is a packet-oriented connection that can take part in multicast
+// groups.
+type PacketConn interface {
+	net.PacketConn
+
+	// JoinGroup joins group on iface.
+	JoinGroup(iface *net.Interface, group net.Addr) error
+
+	// SetMulticastTTL sets the TTL (IPv4) or hop limit (IPv6) of outgoing
+	// multicast packets.
+	SetMulticastTTL(ttl int) error
+
+	// SetMulticastLoopback controls whether outgoing multicast packets are
+	// delivered back to the local host.
+	SetMulticastLoopback(on bool) error
+
+	// SetReadBuffer sets the size of the receive buffer.
+	SetReadBuffer(bytes int) error
+}
+
+// Transport creates the packet connections used to send and receive mDNS
+// packets.
+type Transport interface {
+	// Interfaces returns the interfaces on which multicast groups are joined.
+	Interfaces() ([]net.Interface, error)
+
+	// ListenPacket binds a packet connection to addr. Network is either
+	// "udp4" or "udp6".
+	ListenPacket(network string, addr *net.UDPAddr) (PacketConn, error)
+}
+
+// UDPTransport is the Transport backed by the host's UDP sockets.
+type UDPTransport struct {
+}
+
+func (UDPTransport) Interfaces() ([]net.Interface, error) {
+	return net.Interfaces()
+}
+
+// InterfaceAddrs returns the addresses of the host.
+func (UDPTransport) InterfaceAddrs() ([]net.Addr, error) {
+	return net.InterfaceAddrs()
+}
+
+func (UDPTransport) ListenPacket(network string, addr *net.UDPAddr) (PacketConn, error) {
+	conn, err := listenUDP(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch network {
+	case "udp4":
+		return newIPv4PacketConn(conn), nil
+	case "udp6":
+		return newIPv6PacketConn(conn), nil
+	}
+	conn.Close()
+	return nil, net.UnknownNetworkError(network)
+}
@@ -0,0 +1,131 @@
+package mdns_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/smartwalle/mdns"
+	"github.com/smartwalle/mdns/memnet"
+)
+
+// errJoinRefused is returned by the conns of joinFailer.
+var errJoinRefused = errors.New("join refused")
+
+// joinFailer is a Transport whose conns cannot join groups on the interface
+// named fail.
+type joinFailer struct {
+	mdns.Transport
+	fail string
+}
+
+func (t joinFailer) ListenPacket(network string, addr *net.UDPAddr) (mdns.PacketConn, error) {
+	var conn, err = t.Transport.ListenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return failingConn{PacketConn: conn, fail: t.fail}, nil
+}
+
+type failingConn struct {
+	mdns.PacketConn
+	fail string
+}
+
+func (c failingConn) JoinGroup(iface *net.Interface, group net.Addr) error {
+	if iface.Name == c.fail {
+		return errJoinRefused
+	}
+	return c.PacketConn.JoinGroup(iface, group)
+}
+
+// joinHost returns a memnet host with two interfaces.
+func joinHost() *memnet.Host {
+	var network = memnet.NewNetwork()
+	var host = network.NewHost("server")
+	host.AddInterface("eth0", network.NewLink("lan0"), net.IPv4(192, 0, 2, 1))
+	host.AddInterface("eth1", network.NewLink("lan1"), net.IPv4(198, 51, 100, 1))
+	return host
+}
+
+// startJoin starts a server with opts and returns the error of Start and the
+// interfaces reported through OnWarning.
+func startJoin(t *testing.T, opts ...mdns.ServerOption) (error, []string) {
+	var server = mdns.NewServer(opts...)
+	server.EnableIPv4()
+	var warned []string
+	server.OnWarning(func(addr net.Addr, err error) {
+		var jErr *mdns.JoinError
+		if !errors.As(err, &jErr) {
+			t.Errorf("warned %v, want a *JoinError", err)
+			return
+		}
+		warned = append(warned, jErr.Interface.Name)
+	})
+	var err = server.Start(context.Background())
+	t.Cleanup(func() { server.Stop(context.Background()) })
+	return err, warned
+}
+
+func TestJoinFailures(t *testing.T) {
+	var tests = []struct {
+		name      string
+		opts      []mdns.ServerOption
+		wantWarn  []string
+		wantErr   bool
+		wantFails []string
+	}{
+		{
+			name:     "one interface",
+			opts:     []mdns.ServerOption{mdns.WithTransport(joinFailer{Transport: joinHost(), fail: "eth1"})},
+			wantWarn: []string{"eth1"},
+		},
+		{
+			name:      "one interface, strict",
+			opts:      []mdns.ServerOption{mdns.WithTransport(joinFailer{Transport: joinHost(), fail: "eth1"}), mdns.WithStrictJoin()},
+			wantWarn:  []string{"eth1"},
+			wantErr:   true,
+			wantFails: []string{"eth1"},
+		},
+		{
+			// memnet refuses to join an address that is not multicast.
+			name:      "every interface",
+			opts:      []mdns.ServerOption{mdns.WithTransport(joinHost()), mdns.WithGroupIPv4(net.IPv4(192, 0, 2, 251))},
+			wantWarn:  []string{"eth0", "eth1"},
+			wantErr:   true,
+			wantFails: []string{"eth0", "eth1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err, warned = startJoin(t, tt.opts...)
+			if !reflect.DeepEqual(warned, tt.wantWarn) {
+				t.Errorf("warned for %v, want %v", warned, tt.wantWarn)
+			}
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Start: %v, want success", err)
+				}
+				return
+			}
+
+			var gErr *mdns.JoinGroupError
+			if !errors.As(err, &gErr) {
+				t.Fatalf("Start: %v, want a *JoinGroupError", err)
+			}
+			var failed []string
+			for _, iface := range gErr.FailedInterfaces() {
+				failed = append(failed, iface.Name)
+			}
+			if gErr.Interfaces != 2 || !reflect.DeepEqual(failed, tt.wantFails) {
+				t.Fatalf("Start failed on %v of %d interfaces, want %v of 2", failed, gErr.Interfaces, tt.wantFails)
+			}
+			var jErr *mdns.JoinError
+			if !errors.As(err, &jErr) || jErr.Interface.Name != tt.wantFails[0] {
+				t.Fatalf("Start: %v, want it to wrap the *JoinError of %s", err, tt.wantFails[0])
+			}
+		})
+	}
+}
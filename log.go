@@ -0,0 +1,96 @@
+package mdns
+
+import (
+	"context"
+	"golang.org/x/net/dns/dnsmessage"
+	"log/slog"
+	"net"
+)
+
+// logs reports whether the logger set with WithLogger logs at level, so that
+// the attributes of a record are only built when it is logged.
+func (m *mDNS) logs(level slog.Level) bool {
+	return m.logger != nil && m.logger.Enabled(context.Background(), level)
+}
+
+func (m *mDNS) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if m.logs(level) {
+		m.logger.LogAttrs(context.Background(), level, msg, attrs...)
+	}
+}
+
+// messageAttrs describes message by the name and type of its first question,
+// or of its first answer if it has no question.
+func messageAttrs(message dnsmessage.Message) []slog.Attr {
+	var attrs = make([]slog.Attr, 0, 4)
+	switch {
+	case len(message.Questions) > 0:
+		attrs = append(attrs,
+			slog.String("name", message.Questions[0].Name.String()),
+			slog.String("type", message.Questions[0].Type.String()),
+		)
+	case len(message.Answers) > 0:
+		attrs = append(attrs,
+			slog.String("name", message.Answers[0].Header.Name.String()),
+			slog.String("type", message.Answers[0].Header.Type.String()),
+		)
+	}
+	return append(attrs,
+		slog.Bool("response", message.Header.Response),
+		slog.Int("records", len(message.Answers)+len(message.Authorities)+len(message.Additionals)),
+	)
+}
+
+// logSend logs the messages sent to dst, or multicast if dst is nil, and the
+// error of the send.
+func (m *mDNS) logSend(messages []dnsmessage.Message, dst *net.UDPAddr, err error) {
+	var level, msg = slog.LevelDebug, "sent message"
+	if err != nil {
+		level, msg = slog.LevelWarn, "failed to send message"
+	}
+	if !m.logs(level) {
+		return
+	}
+
+	var to = slog.String("dst", "multicast")
+	if dst != nil {
+		to = slog.String("dst", dst.String())
+	}
+	for _, message := range messages {
+		var attrs = append(messageAttrs(message), to)
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+		}
+		m.log(level, msg, attrs...)
+	}
+}
+
+func (m *mDNS) logOpen(network string, addr net.Addr) {
+	m.log(slog.LevelInfo, "opened socket", slog.String("network", network), slog.Any("addr", addr))
+}
+
+func (m *mDNS) logJoin(iface *net.Interface, group net.Addr) {
+	m.log(slog.LevelDebug, "joined multicast group", slog.String("iface", iface.Name), slog.Any("group", group))
+}
+
+func (m *mDNS) logRecovery(event RecoveryEvent) {
+	var level = slog.LevelWarn
+	switch event.State {
+	case RecoveryTransient:
+		level = slog.LevelDebug
+	case RecoveryDone:
+		level = slog.LevelInfo
+	}
+	if !m.logs(level) {
+		return
+	}
+
+	var attrs = []slog.Attr{slog.String("state", event.State.String()), slog.Any("addr", event.Addr)}
+	if event.Attempt > 0 {
+		attrs = append(attrs, slog.Int("attempt", event.Attempt))
+	}
+	if event.Err != nil {
+		attrs = append(attrs, slog.Any("error", event.Err))
+	}
+	m.log(level, "socket recovery", attrs...)
+}
@@ -11,7 +11,10 @@ import (
 	"fmt"
 	"github.com/smartwalle/mdns/internal"
 	"golang.org/x/net/dns/dnsmessage"
+	"log/slog"
 	"net"
+	"sync"
+	"time"
 )
 
 // Port is the mDNS port required of the spec
@@ -23,25 +26,199 @@ var mDNSMulticastIPv6 = net.ParseIP("ff02::fb")
 var mDNSWildcardIPv4 = net.ParseIP("224.0.0.0")
 var mDNSWildcardIPv6 = net.ParseIP("ff02::")
 
+// Transport creates the packet connections used by Client and Server. It can be
+// replaced with WithTransport, for example to run over an in-memory network.
+type Transport = internal.Transport
+
+// PacketConn is a packet connection created by a Transport.
+type PacketConn = internal.PacketConn
+
+// JoinError is reported through OnWarning for every interface on which the
+// multicast group could not be joined.
+type JoinError = internal.JoinError
+
+// defaultTTL is the IP TTL (IPv4) and hop limit (IPv6) of the packets sent,
+// as RFC 6762 §11 requires, so that receivers can tell that they come from
+// the local link.
+const defaultTTL = 255
+
 type mDNS struct {
-	conn4    *internal.Conn
-	conn6    *internal.Conn
-	qHandler func(net.Addr, Question)
-	rHandler func(net.Addr, Resource)
-	wHandler func(net.Addr, error)
-	eHandler func(error)
+	mu         sync.Mutex
+	hmu        sync.RWMutex
+	jmu        sync.Mutex
+	joinErrors []*JoinError
+	run        *run
+	conn4      *internal.Conn
+	conn6      *internal.Conn
+	qHandler   func(net.Addr, Question)
+	rHandler   func(net.Addr, Resource)
+	mHandler   func(net.Addr, Message)
+	dHandler   func(net.Addr, DropReason)
+	rcHandler  func(RecoveryEvent)
+	wHandler   func(net.Addr, error)
+	eHandler   func(error)
+	strictJoin bool
+	port       int
+	group4     net.IP
+	group6     net.IP
+	bind4      net.IP
+	bind6      net.IP
+	ttl        int
+	loopback   bool
+	readBuffer int
+	logger     *slog.Logger
+	clock      Clock
+	transport  Transport
+
+	dispatchMode DispatchMode
+	workers      int
+	queueDepth   int
+	dropPolicy   DropPolicy
+	stats        stats
+	multicastAll bool
+	parseMode    ParseMode
+	validation   ValidationRule
+	subnets      subnetCache
+	limiter      limiter
+	ownPackets   OwnPacketMode
+	dedupWindow  time.Duration
+	locals       localAddrs
+	backoff      Backoff
+	maxAttempts  int
+
+	inMiddleware  []InboundMiddleware
+	outMiddleware []OutboundMiddleware
+	inbound       Inbound
+	outbound      Outbound
+}
+
+func newMDNS() *mDNS {
+	var m = &mDNS{
+		port:      Port,
+		group4:    mDNSMulticastIPv4,
+		group6:    mDNSMulticastIPv6,
+		bind4:     mDNSWildcardIPv4,
+		bind6:     mDNSWildcardIPv6,
+		ttl:       defaultTTL,
+		loopback:  true,
+		clock:     systemClock{},
+		transport: internal.UDPTransport{},
+
+		workers:    defaultWorkers,
+		queueDepth: defaultQueueDepth,
+		validation: ValidateAll,
+		backoff:    ExponentialBackoff(defaultMinBackoff, defaultMaxBackoff),
+	}
+	m.buildChains()
+	return m
+}
+
+// factory4 returns the factory for IPv4 sockets, joining the multicast group
+// if join is set.
+func (m *mDNS) factory4(join bool) internal.PacketConnFactory {
+	var factory = &internal.SocketFactory{
+		Network:     "udp4",
+		Transport:   m.transport,
+		Loopback:    m.loopback,
+		ReadBuffer:  m.readBuffer,
+		Strict:      m.strictJoin,
+		OnJoinError: m.joinWarning,
+		OnJoin:      m.logJoin,
+		OnOpen:      m.logOpen,
+		Control:     m.validation&(ValidateHopLimit|ValidateSourceAddress) != 0,
+	}
+	if join {
+		factory.Group = &net.UDPAddr{IP: m.group4}
+	}
+	return factory
+}
+
+// factory6 returns the factory for IPv6 sockets, joining the multicast group
+// if join is set.
+func (m *mDNS) factory6(join bool) internal.PacketConnFactory {
+	var factory = &internal.SocketFactory{
+		Network:     "udp6",
+		Transport:   m.transport,
+		Loopback:    m.loopback,
+		ReadBuffer:  m.readBuffer,
+		Strict:      m.strictJoin,
+		OnJoinError: m.joinWarning,
+		OnJoin:      m.logJoin,
+		OnOpen:      m.logOpen,
+		Control:     m.validation&(ValidateHopLimit|ValidateSourceAddress) != 0,
+	}
+	if join {
+		factory.Group = &net.UDPAddr{IP: m.group6}
+	}
+	return factory
+}
+
+// joinWarning queues err, as sockets are created with locks held that the
+// OnWarning handler may need. The queue is reported by reportJoinErrors.
+func (m *mDNS) joinWarning(err *JoinError) {
+	m.log(slog.LevelWarn, "failed to join multicast group", slog.String("iface", err.Interface.Name), slog.Any("group", err.Group), slog.Any("error", err.Err))
+	m.jmu.Lock()
+	defer m.jmu.Unlock()
+	m.joinErrors = append(m.joinErrors, err)
 }
 
+// localPort returns the port m listens on.
+func (m *mDNS) localPort() int {
+	return m.port
+}
+
+// reportJoinErrors passes the queued join errors to the OnWarning handler. It
+// must be called without holding any lock.
+func (m *mDNS) reportJoinErrors() {
+	m.jmu.Lock()
+	var errs = m.joinErrors
+	m.joinErrors = nil
+	m.jmu.Unlock()
+
+	for _, err := range errs {
+		m.warn(err.Group, err)
+	}
+}
+
+func (m *mDNS) warn(addr net.Addr, err error) {
+	m.hmu.RLock()
+	var handler = m.wHandler
+	m.hmu.RUnlock()
+	if handler != nil {
+		handler(addr, err)
+	}
+}
+
+func (m *mDNS) fail(err error) {
+	m.log(slog.LevelError, "fatal error", slog.Any("error", err))
+	m.hmu.RLock()
+	var handler = m.eHandler
+	m.hmu.RUnlock()
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// Close stops m without waiting for its goroutines to exit, so it may be
+// called from a handler. Use Wait or Stop to wait for them.
 func (m *mDNS) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.run != nil {
+		m.run.halt()
+	}
+	return m.closeConns()
+}
+
+func (m *mDNS) closeConns() error {
 	var err4 error
 	if m.conn4 != nil {
 		err4 = m.conn4.Close()
-		m.conn4 = nil
 	}
 	var err6 error
 	if m.conn6 != nil {
 		err6 = m.conn6.Close()
-		m.conn6 = nil
 	}
 
 	if err4 != nil {
@@ -51,6 +228,9 @@ func (m *mDNS) Close() error {
 }
 
 func (m *mDNS) SetMulticastTTL(ttl int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.conn4 != nil {
 		if err := m.conn4.SetMulticastTTL(ttl); err != nil {
 			return err
@@ -65,66 +245,148 @@ func (m *mDNS) SetMulticastTTL(ttl int) error {
 }
 
 func (m *mDNS) OnQuestion(handler func(net.Addr, Question)) {
+	m.hmu.Lock()
+	defer m.hmu.Unlock()
 	m.qHandler = handler
 }
 
 func (m *mDNS) OnResource(handler func(net.Addr, Resource)) {
+	m.hmu.Lock()
+	defer m.hmu.Unlock()
 	m.rHandler = handler
 }
 
+func (m *mDNS) OnMessage(handler func(net.Addr, Message)) {
+	m.hmu.Lock()
+	defer m.hmu.Unlock()
+	m.mHandler = handler
+}
+
 // OnWarning calls f on every non-fatal error.
 func (m *mDNS) OnWarning(handler func(net.Addr, error)) {
+	m.hmu.Lock()
+	defer m.hmu.Unlock()
 	m.wHandler = handler
 }
 
 // OnError calls f on every fatal error. After
 // all active handlers are called, m will stop listening and
 // close it's connection so this function will not be called twice.
+// A read error is only fatal once socket recovery gives up, or if it was
+// disabled with WithRecovery.
 func (m *mDNS) OnError(handler func(error)) {
+	m.hmu.Lock()
+	defer m.hmu.Unlock()
 	m.eHandler = handler
 }
 
+// conns returns the connections enabled on m.
+func (m *mDNS) conns() (conn4, conn6 *internal.Conn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conn4, m.conn6
+}
+
 // SendTo serializes and sends packet to dst. If dst is a multicast
 // address then packet is multicast to the corresponding group on
 // all interfaces. Note that start must be called prior to making this
 // call.
 func (m *mDNS) SendTo(message dnsmessage.Message, dst *net.UDPAddr) error {
-	var b, err = message.Pack()
+	return m.outbound(message, dst)
+}
+
+// Multicast serializes and sends packet out as a multicast to all interfaces
+// using the port that m is listening on. Note that Start must be
+// called prior to making this call.
+func (m *mDNS) Multicast(message dnsmessage.Message) error {
+	return m.outbound(message, nil)
+}
+
+// MulticastBatch serializes messages and multicasts them in one round, using
+// a single system call per address family where the platform supports it.
+func (m *mDNS) MulticastBatch(messages []dnsmessage.Message) error {
+	if len(m.outMiddleware) == 0 {
+		return m.multicast(messages)
+	}
+
+	var queued = make([]dnsmessage.Message, 0, len(messages))
+	var nOutbound = chainOutbound(m.outMiddleware, func(message dnsmessage.Message, dst *net.UDPAddr) error {
+		if dst != nil {
+			return m.sendTo(message, dst)
+		}
+		queued = append(queued, message)
+		return nil
+	})
+	for _, message := range messages {
+		if err := nOutbound(message, nil); err != nil {
+			return err
+		}
+	}
+	return m.multicast(queued)
+}
+
+// send is the end of the outbound middleware chain.
+func (m *mDNS) send(message dnsmessage.Message, dst *net.UDPAddr) error {
+	if dst == nil {
+		return m.multicast([]dnsmessage.Message{message})
+	}
+	return m.sendTo(message, dst)
+}
+
+func (m *mDNS) sendTo(message dnsmessage.Message, dst *net.UDPAddr) (err error) {
+	defer func() {
+		m.logSend([]dnsmessage.Message{message}, dst, err)
+	}()
+
+	payloads, release, err := packAll([]dnsmessage.Message{message})
 	if err != nil {
 		return err
 	}
+	defer release()
+	sent.add(payloads[0])
 
+	var conn4, conn6 = m.conns()
 	if dst.IP.To4() != nil {
-		if m.conn4 != nil {
-			return m.conn4.SendTo(b, dst)
+		if conn4 != nil {
+			return conn4.SendBatch(payloads, dst, false)
 		} else {
-			return fmt.Errorf("IPv4 was not enabled")
+			return ErrIPv4Disabled
 		}
 	} else {
-		if m.conn6 != nil {
-			return m.conn6.SendTo(b, dst)
+		if conn6 != nil {
+			return conn6.SendBatch(payloads, dst, false)
 		} else {
-			return fmt.Errorf("IPv6 was not enabled")
+			return ErrIPv6Disabled
 		}
 	}
 }
 
-// Multicast serializes and sends packet out as a multicast to all interfaces
-// using the port that m is listening on. Note that Start must be
-// called prior to making this call.
-func (m *mDNS) Multicast(message dnsmessage.Message) error {
-	var b, err = message.Pack()
+func (m *mDNS) multicast(messages []dnsmessage.Message) (err error) {
+	defer func() {
+		m.logSend(messages, nil, err)
+	}()
+
+	var conn4, conn6 = m.conns()
+	if conn4 == nil && conn6 == nil {
+		return ErrNoConnection
+	}
+
+	payloads, release, err := packAll(messages)
 	if err != nil {
 		return err
 	}
+	defer release()
+	for _, payload := range payloads {
+		sent.add(payload)
+	}
 
 	var err4 error
-	if m.conn4 != nil {
-		err4 = m.conn4.Multicast(b)
+	if conn4 != nil {
+		err4 = conn4.MulticastBatch(payloads, m.multicastAll)
 	}
 	var err6 error
-	if m.conn6 != nil {
-		err6 = m.conn6.Multicast(b)
+	if conn6 != nil {
+		err6 = conn6.MulticastBatch(payloads, m.multicastAll)
 	}
 	if err4 != nil {
 		return err4
@@ -134,10 +396,10 @@ func (m *mDNS) Multicast(message dnsmessage.Message) error {
 
 func (m *mDNS) initMDNSConn() error {
 	if m.conn4 == nil && m.conn6 == nil {
-		return fmt.Errorf("no connection active")
+		return ErrNoConnection
 	}
 
-	ifaces, err := net.Interfaces()
+	ifaces, err := m.transport.Interfaces()
 	if err != nil {
 		return fmt.Errorf("listing interfaces: %w", err)
 	}
@@ -155,85 +417,117 @@ func (m *mDNS) initMDNSConn() error {
 	return nil
 }
 
+// run tracks the goroutines of one Start call.
+type run struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func (r *run) halt() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+// Start opens the sockets and starts listening. It may be called again once
+// the goroutines of the previous call have exited.
 func (m *mDNS) Start(ctx context.Context) error {
+	var err = m.start(ctx)
+	m.reportJoinErrors()
+	return err
+}
+
+func (m *mDNS) start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.run != nil {
+		select {
+		case <-m.run.done:
+		default:
+			return ErrAlreadyStarted
+		}
+	}
+
 	if err := m.initMDNSConn(); err != nil {
-		_ = m.Close()
+		_ = m.closeConns()
 		return err
 	}
-	go func() {
-		// NOTE: This defer statement will close connections, which will force
-		// the goroutines started by Listen() to exit.
-		defer func() {
-			_ = m.Close()
-		}()
 
-		var quit = make(chan struct{})
-		defer close(quit)
+	var nRun = &run{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	m.run = nRun
 
-		var packets = make(chan internal.Packet, 1)
+	var quit = make(chan struct{})
+	var packets = make(chan internal.Packet, m.queueDepth)
+	var listeners sync.WaitGroup
 
-		if m.conn4 != nil {
-			m.conn4.Listen(packets, quit)
-		}
-		if m.conn6 != nil {
-			m.conn6.Listen(packets, quit)
-		}
+	if m.conn4 != nil {
+		m.conn4.Listen(packets, quit, &listeners, m.supervisor())
+	}
+	if m.conn6 != nil {
+		m.conn6.Listen(packets, quit, &listeners, m.supervisor())
+	}
 
-		var parser = &dnsmessage.Parser{}
+	var nDispatcher = m.newDispatcher()
+	var nDeduplicator = m.newDeduplicator()
+	var flush <-chan uint64
+	if nDeduplicator != nil {
+		flush = nDeduplicator.flush
+	}
+
+	go func() {
+		defer close(nRun.done)
+
+		// NOTE: Closing the connections forces the goroutines started by
+		// Listen() to exit.
+		defer func() {
+			close(quit)
+			m.mu.Lock()
+			_ = m.closeConns()
+			m.mu.Unlock()
+			listeners.Wait()
+			if nDeduplicator != nil {
+				nDeduplicator.close()
+			}
+			nDispatcher.close()
+		}()
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-nRun.stop:
+				return
 			case received := <-packets:
+				select {
+				case <-nRun.stop:
+					// Read errors caused by Close are not reported.
+					return
+				default:
+				}
 				if received.Error != nil {
-					if m.eHandler != nil {
-						m.eHandler(received.Error)
-					}
+					m.fail(received.Error)
 					continue
 				}
-
-				var header dnsmessage.Header
-				var err error
-
-				if header, err = parser.Start(received.Data); err != nil {
-					if m.wHandler != nil {
-						m.wHandler(received.Addr, err)
-					}
+				m.stats.received.Add(1)
+				received.Time = m.clock.Now()
+				if reason, ok := m.limiter.allow(received.Addr, received.Time); !ok {
+					received.Release()
+					m.stats.rateLimited.Add(1)
+					m.drop(received.Addr, reason)
 					continue
 				}
-
-				if m.qHandler != nil {
-					var questions, _ = parser.AllQuestions()
-					if len(questions) > 0 {
-						var nQuestion = Question{
-							Header:    header,
-							Questions: questions,
-						}
-						m.qHandler(received.Addr, nQuestion)
-					}
-				} else {
-					_ = parser.SkipAllQuestions()
+				if nDeduplicator != nil && nDeduplicator.hold(received) {
+					continue
 				}
-
-				if m.rHandler != nil {
-					var answers, _ = parser.AllAnswers()
-					var authorities, _ = parser.AllAuthorities()
-					var additionals, _ = parser.AllAdditionals()
-
-					if len(answers) > 0 || len(authorities) > 0 || len(additionals) > 0 {
-						var nResource = Resource{
-							Header:      header,
-							Answers:     answers,
-							Authorities: authorities,
-							Additionals: additionals,
-						}
-						m.rHandler(received.Addr, nResource)
-					}
-				} else {
-					_ = parser.SkipAllAnswers()
-					_ = parser.SkipAllAuthorities()
-					_ = parser.SkipAllAdditionals()
+				nDispatcher.dispatch(received)
+			case key := <-flush:
+				if received, ok := nDeduplicator.release(key); ok {
+					nDispatcher.dispatch(received)
 				}
 			}
 		}
@@ -241,6 +535,111 @@ func (m *mDNS) Start(ctx context.Context) error {
 	return nil
 }
 
+// handle parses a received packet, passes it through the inbound middleware
+// and releases the packet buffer. The handlers only see parsed copies of the
+// data.
+func (m *mDNS) handle(parser *dnsmessage.Parser, received internal.Packet) {
+	defer received.Release()
+
+	m.hmu.RLock()
+	var all = len(m.inMiddleware) > 0 || m.mHandler != nil
+	var questions, resources = all || m.qHandler != nil, all || m.rHandler != nil
+	m.hmu.RUnlock()
+
+	var own = m.own(received.Addr, received.Data, received.Time)
+	if own && m.ownPackets == OwnFilter {
+		m.stats.own.Add(1)
+		m.drop(received.Addr, ReasonOwn)
+		return
+	}
+
+	var nMessage, pErr = parseMessage(parser, received.Data, questions, resources)
+	if pErr != nil {
+		if m.parseMode == ParseStrict || pErr.Section == SectionHeader {
+			m.log(slog.LevelWarn, "dropped malformed packet", slog.Any("src", received.Addr), slog.Any("error", pErr))
+			m.warn(received.Addr, pErr)
+			return
+		}
+		m.log(slog.LevelDebug, "received malformed packet", slog.Any("src", received.Addr), slog.Any("error", pErr))
+		nMessage.Malformed = pErr
+	}
+	nMessage.Size = len(received.Data)
+	nMessage.ReceivedAt = received.Time
+	nMessage.HopLimit = received.HopLimit
+	nMessage.IfIndex = received.IfIndex
+	nMessage.Own = own
+	if len(received.Also) > 0 {
+		nMessage.Addrs = append([]net.Addr{received.Addr}, received.Also...)
+	}
+
+	if !m.validate(received.Addr, &nMessage) {
+		return
+	}
+	m.inbound(received.Addr, nMessage)
+}
+
+// deliver is the end of the inbound middleware chain. It calls the handlers
+// of m with message.
+func (m *mDNS) deliver(src net.Addr, message Message) {
+	m.hmu.RLock()
+	var qHandler, rHandler, mHandler = m.qHandler, m.rHandler, m.mHandler
+	m.hmu.RUnlock()
+
+	if mHandler != nil {
+		mHandler(src, message)
+	}
+
+	if qHandler != nil && len(message.Questions) > 0 {
+		var nQuestion = Question{
+			Header:    message.Header,
+			Questions: message.Questions,
+		}
+		qHandler(src, nQuestion)
+	}
+
+	if rHandler != nil && (len(message.Answers) > 0 || len(message.Authorities) > 0 || len(message.Additionals) > 0) {
+		var nResource = Resource{
+			Header:      message.Header,
+			Answers:     message.Answers,
+			Authorities: message.Authorities,
+			Additionals: message.Additionals,
+		}
+		rHandler(src, nResource)
+	}
+}
+
+// Stop stops m and waits until its goroutines have exited or ctx is done.
 func (m *mDNS) Stop(ctx context.Context) error {
-	return m.Close()
+	var err = m.Close()
+
+	select {
+	case <-m.Done():
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var closedChan = make(chan struct{})
+
+func init() {
+	close(closedChan)
+}
+
+// Done returns a channel that is closed once the goroutines started by the
+// last call to Start have exited. It is closed if m was never started.
+func (m *mDNS) Done() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.run == nil {
+		return closedChan
+	}
+	return m.run.done
+}
+
+// Wait blocks until the goroutines started by the last call to Start have
+// exited.
+func (m *mDNS) Wait() {
+	<-m.Done()
 }
@@ -0,0 +1,141 @@
+package mdns_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smartwalle/mdns"
+	"github.com/smartwalle/mdns/memnet"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// lifecycle is a server on a memnet host and a conn on another host to send
+// it queries.
+type lifecycle struct {
+	server mdns.Server
+	peer   mdns.PacketConn
+}
+
+func newLifecycle(t *testing.T, opts ...mdns.ServerOption) *lifecycle {
+	var network = memnet.NewNetwork()
+	var lan = network.NewLink("lan")
+	var serverHost = network.NewHost("server")
+	serverHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 1))
+	var peerHost = network.NewHost("peer")
+	peerHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 2))
+
+	var l = &lifecycle{server: mdns.NewServer(append([]mdns.ServerOption{mdns.WithTransport(serverHost)}, opts...)...)}
+	l.server.EnableIPv4()
+	var err error
+	if l.peer, err = peerHost.ListenPacket("udp4", &net.UDPAddr{Port: mdns.Port}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		l.peer.Close()
+		l.server.Stop(context.Background())
+	})
+	return l
+}
+
+// query sends a query to the server.
+func (l *lifecycle) query(t *testing.T) {
+	t.Helper()
+	var data, err = (&dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("printer.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.peer.WriteTo(data, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: mdns.Port}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	var l = newLifecycle(t)
+	var received = make(chan struct{}, 1)
+	l.server.OnQuestion(func(net.Addr, mdns.Question) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := l.server.Start(context.Background()); err != nil {
+			t.Fatalf("Start %d: %v", i, err)
+		}
+		if err := l.server.Start(context.Background()); !errors.Is(err, mdns.ErrAlreadyStarted) {
+			t.Fatalf("Start %d again: %v, want ErrAlreadyStarted", i, err)
+		}
+		l.query(t)
+		waitFor(t, received, "a query")
+		if err := l.server.Stop(context.Background()); err != nil {
+			t.Fatalf("Stop %d: %v", i, err)
+		}
+		waitFor(t, l.server.Done(), "Done")
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	var l = newLifecycle(t)
+	var entered = make(chan struct{})
+	var release = make(chan struct{})
+	l.server.OnQuestion(func(net.Addr, mdns.Question) {
+		close(entered)
+		<-release
+	})
+	if err := l.server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.query(t)
+	waitFor(t, entered, "the handler")
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.server.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop with a blocked handler: %v, want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-l.server.Done():
+		t.Fatal("Done closed while a handler is running")
+	default:
+	}
+
+	close(release)
+	waitFor(t, l.server.Done(), "Done")
+	if err := l.server.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop after the handler returned: %v", err)
+	}
+}
+
+func TestDoneAfterCancel(t *testing.T) {
+	var l = newLifecycle(t)
+	var ctx, cancel = context.WithCancel(context.Background())
+	if err := l.server.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-l.server.Done():
+		t.Fatal("Done closed before the context was canceled")
+	default:
+	}
+
+	cancel()
+	waitFor(t, l.server.Done(), "Done")
+	if err := l.server.Start(context.Background()); err != nil {
+		t.Fatalf("Start after the context was canceled: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package mdnstest
+
+import (
+	"fmt"
+	"github.com/smartwalle/mdns"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// FindRecords returns the records in the answer, authority and additional
+// sections of resources that are named name and have type typ. Names are
+// compared case-insensitively, with or without the trailing dot.
+func FindRecords(resources []mdns.Resource, name string, typ dnsmessage.Type) []dnsmessage.Resource {
+	var records []dnsmessage.Resource
+	for _, resource := range resources {
+		for _, section := range [][]dnsmessage.Resource{resource.Answers, resource.Authorities, resource.Additionals} {
+			for _, record := range section {
+				if record.Header.Type == typ && sameName(record.Header.Name.String(), name) {
+					records = append(records, record)
+				}
+			}
+		}
+	}
+	return records
+}
+
+// FindQuestions returns the questions named name with type typ.
+func FindQuestions(questions []mdns.Question, name string, typ dnsmessage.Type) []dnsmessage.Question {
+	var found []dnsmessage.Question
+	for _, question := range questions {
+		for _, q := range question.Questions {
+			if q.Type == typ && sameName(q.Name.String(), name) {
+				found = append(found, q)
+			}
+		}
+	}
+	return found
+}
+
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// expect fails t unless one of the records named name with type typ satisfies
+// match, and returns that record.
+func expect(t testing.TB, resources []mdns.Resource, name string, typ dnsmessage.Type, want string, match func(dnsmessage.ResourceBody) bool) dnsmessage.ResourceBody {
+	t.Helper()
+
+	var records = FindRecords(resources, name, typ)
+	for _, record := range records {
+		if match(record.Body) {
+			return record.Body
+		}
+	}
+
+	var found = make([]string, 0, len(records))
+	for _, record := range records {
+		found = append(found, record.Body.GoString())
+	}
+	t.Fatalf("expected %s record for %s with %s, found %d: %s", typ, name, want, len(records), strings.Join(found, ", "))
+	return nil
+}
+
+// ExpectSRV fails t unless resources hold an SRV record for name with port.
+func ExpectSRV(t testing.TB, resources []mdns.Resource, name string, port uint16) *dnsmessage.SRVResource {
+	t.Helper()
+	var body = expect(t, resources, name, dnsmessage.TypeSRV, fmt.Sprintf("port %d", port), func(body dnsmessage.ResourceBody) bool {
+		srv, ok := body.(*dnsmessage.SRVResource)
+		return ok && srv.Port == port
+	})
+	var record, _ = body.(*dnsmessage.SRVResource)
+	return record
+}
+
+// ExpectA fails t unless resources hold an A record for name with ip.
+func ExpectA(t testing.TB, resources []mdns.Resource, name string, ip net.IP) *dnsmessage.AResource {
+	t.Helper()
+	var body = expect(t, resources, name, dnsmessage.TypeA, fmt.Sprintf("address %s", ip), func(body dnsmessage.ResourceBody) bool {
+		a, ok := body.(*dnsmessage.AResource)
+		return ok && net.IP(a.A[:]).Equal(ip)
+	})
+	var record, _ = body.(*dnsmessage.AResource)
+	return record
+}
+
+// ExpectAAAA fails t unless resources hold an AAAA record for name with ip.
+func ExpectAAAA(t testing.TB, resources []mdns.Resource, name string, ip net.IP) *dnsmessage.AAAAResource {
+	t.Helper()
+	var body = expect(t, resources, name, dnsmessage.TypeAAAA, fmt.Sprintf("address %s", ip), func(body dnsmessage.ResourceBody) bool {
+		aaaa, ok := body.(*dnsmessage.AAAAResource)
+		return ok && net.IP(aaaa.AAAA[:]).Equal(ip)
+	})
+	var record, _ = body.(*dnsmessage.AAAAResource)
+	return record
+}
+
+// ExpectPTR fails t unless resources hold a PTR record for name pointing to
+// target.
+func ExpectPTR(t testing.TB, resources []mdns.Resource, name string, target string) *dnsmessage.PTRResource {
+	t.Helper()
+	var body = expect(t, resources, name, dnsmessage.TypePTR, fmt.Sprintf("target %s", target), func(body dnsmessage.ResourceBody) bool {
+		ptr, ok := body.(*dnsmessage.PTRResource)
+		return ok && sameName(ptr.PTR.String(), target)
+	})
+	var record, _ = body.(*dnsmessage.PTRResource)
+	return record
+}
+
+// ExpectTXT fails t unless resources hold a TXT record for name with exactly
+// the strings txt.
+func ExpectTXT(t testing.TB, resources []mdns.Resource, name string, txt ...string) *dnsmessage.TXTResource {
+	t.Helper()
+	var body = expect(t, resources, name, dnsmessage.TypeTXT, fmt.Sprintf("text %q", txt), func(body dnsmessage.ResourceBody) bool {
+		record, ok := body.(*dnsmessage.TXTResource)
+		return ok && reflect.DeepEqual(record.TXT, txt)
+	})
+	var record, _ = body.(*dnsmessage.TXTResource)
+	return record
+}
+
+// ExpectNoRecord fails t if resources hold any record for name with type typ.
+func ExpectNoRecord(t testing.TB, resources []mdns.Resource, name string, typ dnsmessage.Type) {
+	t.Helper()
+	if records := FindRecords(resources, name, typ); len(records) > 0 {
+		t.Fatalf("expected no %s record for %s, found %d", typ, name, len(records))
+	}
+}
+
+// ExpectQuestion fails t unless questions ask for name with type typ.
+func ExpectQuestion(t testing.TB, questions []mdns.Question, name string, typ dnsmessage.Type) dnsmessage.Question {
+	t.Helper()
+	var found = FindQuestions(questions, name, typ)
+	if len(found) == 0 {
+		t.Fatalf("expected question for %s %s", typ, name)
+		return dnsmessage.Question{}
+	}
+	return found[0]
+}
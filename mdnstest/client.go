@@ -0,0 +1,281 @@
+package mdnstest
+
+import (
+	"context"
+	"github.com/smartwalle/mdns"
+	"net"
+	"sync"
+)
+
+// FakeClient is an mdns.Client that records the questions it sends and lets
+// tests inject received packets, so that handlers can be tested without real
+// sockets.
+type FakeClient struct {
+	mu        sync.Mutex
+	ipv4      bool
+	ipv6      bool
+	started   bool
+	done      chan struct{}
+	stats     mdns.Stats
+	questions []mdns.Question
+	queries   map[*mdns.Question]struct{}
+	rHandler  func(net.Addr, mdns.Resource)
+	mHandler  func(net.Addr, mdns.Message)
+	wHandler  func(net.Addr, error)
+	eHandler  func(error)
+	dHandler  func(net.Addr, mdns.DropReason)
+	rcHandler func(mdns.RecoveryEvent)
+
+	// SendErr is returned by Send and Query if not nil.
+	SendErr error
+}
+
+var _ mdns.Client = (*FakeClient)(nil)
+
+// NewFakeClient creates a FakeClient.
+func NewFakeClient() *FakeClient {
+	return &FakeClient{queries: make(map[*mdns.Question]struct{}), done: closedChan()}
+}
+
+func (c *FakeClient) EnableIPv4() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ipv4 = true
+}
+
+func (c *FakeClient) EnableIPv6() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ipv6 = true
+}
+
+func (c *FakeClient) OnResource(handler func(net.Addr, mdns.Resource)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rHandler = handler
+}
+
+func (c *FakeClient) OnMessage(handler func(net.Addr, mdns.Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mHandler = handler
+}
+
+func (c *FakeClient) OnWarning(handler func(net.Addr, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wHandler = handler
+}
+
+func (c *FakeClient) OnError(handler func(error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.eHandler = handler
+}
+
+func (c *FakeClient) OnDrop(handler func(net.Addr, mdns.DropReason)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dHandler = handler
+}
+
+func (c *FakeClient) OnRecovery(handler func(mdns.RecoveryEvent)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rcHandler = handler
+}
+
+func (c *FakeClient) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return mdns.ErrAlreadyStarted
+	}
+	c.started = true
+	c.done = make(chan struct{})
+	return nil
+}
+
+func (c *FakeClient) Send(question mdns.Question) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.SendErr != nil {
+		return c.SendErr
+	}
+	c.questions = append(c.questions, question)
+	return nil
+}
+
+// Query records question once and keeps it in Queries until ctx is done or
+// the client is closed. It returns mdns.ErrNotStarted if the client is not
+// started.
+func (c *FakeClient) Query(ctx context.Context, question mdns.Question) error {
+	c.mu.Lock()
+	var started, done = c.started, c.done
+	c.mu.Unlock()
+	if !started {
+		return mdns.ErrNotStarted
+	}
+	if err := c.Send(question); err != nil {
+		return err
+	}
+
+	var key = &question
+	c.mu.Lock()
+	c.queries[key] = struct{}{}
+	c.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			delete(c.queries, key)
+			c.mu.Unlock()
+		case <-done:
+		}
+	}()
+	return nil
+}
+
+func (c *FakeClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		c.started = false
+		close(c.done)
+	}
+	c.queries = make(map[*mdns.Question]struct{})
+	return nil
+}
+
+func (c *FakeClient) Stop(ctx context.Context) error {
+	return c.Close()
+}
+
+func (c *FakeClient) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done
+}
+
+func (c *FakeClient) Wait() {
+	<-c.Done()
+}
+
+// Stats returns the counters set with SetStats.
+func (c *FakeClient) Stats() mdns.Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// SetStats sets the counters returned by Stats.
+func (c *FakeClient) SetStats(stats mdns.Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats = stats
+}
+
+// Started reports whether Start was called and Close was not called since.
+func (c *FakeClient) Started() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.started
+}
+
+// Questions returns every question sent so far, in order.
+func (c *FakeClient) Questions() []mdns.Question {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]mdns.Question(nil), c.questions...)
+}
+
+// Queries returns the questions passed to Query whose context is not done.
+func (c *FakeClient) Queries() []mdns.Question {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var queries = make([]mdns.Question, 0, len(c.queries))
+	for query := range c.queries {
+		queries = append(queries, *query)
+	}
+	return queries
+}
+
+// Reset forgets every question sent so far.
+func (c *FakeClient) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.questions = nil
+}
+
+// ReceiveResource calls the handlers as if resource was received from src:
+// the OnMessage handler, then the OnResource handler.
+func (c *FakeClient) ReceiveResource(src net.Addr, resource mdns.Resource) {
+	c.ReceiveMessage(src, mdns.Message{
+		Header:      resource.Header,
+		Answers:     resource.Answers,
+		Authorities: resource.Authorities,
+		Additionals: resource.Additionals,
+	})
+}
+
+// ReceiveMessage calls the handlers as if message was received from src, like
+// a Client does: the OnMessage handler, then the OnResource handler if
+// message has records.
+func (c *FakeClient) ReceiveMessage(src net.Addr, message mdns.Message) {
+	c.mu.Lock()
+	var rHandler, mHandler = c.rHandler, c.mHandler
+	c.mu.Unlock()
+
+	if mHandler != nil {
+		mHandler(src, message)
+	}
+	if rHandler != nil && (len(message.Answers) > 0 || len(message.Authorities) > 0 || len(message.Additionals) > 0) {
+		rHandler(src, mdns.Resource{
+			Header:      message.Header,
+			Answers:     message.Answers,
+			Authorities: message.Authorities,
+			Additionals: message.Additionals,
+		})
+	}
+}
+
+// Warn calls the OnWarning handler with src and err.
+func (c *FakeClient) Warn(src net.Addr, err error) {
+	c.mu.Lock()
+	var handler = c.wHandler
+	c.mu.Unlock()
+	if handler != nil {
+		handler(src, err)
+	}
+}
+
+// Fail calls the OnError handler with err.
+func (c *FakeClient) Fail(err error) {
+	c.mu.Lock()
+	var handler = c.eHandler
+	c.mu.Unlock()
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// Recover calls the OnRecovery handler with event.
+func (c *FakeClient) Recover(event mdns.RecoveryEvent) {
+	c.mu.Lock()
+	var handler = c.rcHandler
+	c.mu.Unlock()
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// Drop calls the OnDrop handler with src and reason.
+func (c *FakeClient) Drop(src net.Addr, reason mdns.DropReason) {
+	c.mu.Lock()
+	var handler = c.dHandler
+	c.mu.Unlock()
+	if handler != nil {
+		handler(src, reason)
+	}
+}
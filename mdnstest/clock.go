@@ -0,0 +1,149 @@
+// Package mdnstest provides helpers for testing code built on the mdns
+// package without real sockets or real time.
+package mdnstest
+
+import (
+	"github.com/smartwalle/mdns"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock is an mdns.Clock whose time only moves when Advance or Set is
+// called. Timers fire synchronously from Advance and Set, in the order of
+// their deadlines. The first query of a continuous client also waits a random
+// delay, which mdns.WithRandSource makes predictable.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+var _ mdns.Clock = (*FakeClock)(nil)
+
+// NewFakeClock creates a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) mdns.Timer {
+	var timer = &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	timer.Reset(d)
+	return timer
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) mdns.Timer {
+	var timer = &fakeTimer{clock: c, fn: f}
+	timer.Reset(d)
+	return timer
+}
+
+// Advance moves the clock forward by d, firing every timer that expires on
+// the way.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to t, firing every timer that expires on the way. It
+// does nothing if t is before the current time.
+func (c *FakeClock) Set(t time.Time) {
+	for {
+		c.mu.Lock()
+		if len(c.timers) == 0 || c.timers[0].when.After(t) {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		var timer = c.timers[0]
+		c.timers = c.timers[1:]
+		if timer.when.After(c.now) {
+			c.now = timer.when
+		}
+		var now = c.now
+		c.mu.Unlock()
+
+		timer.fire(now)
+	}
+}
+
+// Pending returns the number of timers waiting to fire.
+func (c *FakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// Next returns the deadline of the earliest pending timer.
+func (c *FakeClock) Next() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.timers) == 0 {
+		return time.Time{}, false
+	}
+	return c.timers[0].when, true
+}
+
+// remove unschedules timer and reports whether it was pending. It must be
+// called with c.mu held.
+func (c *FakeClock) remove(timer *fakeTimer) bool {
+	for i, t := range c.timers {
+		if t == timer {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	ch    chan time.Time
+	fn    func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	var c = t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var active = c.remove(t)
+	t.when = c.now.Add(d)
+	var i = sort.Search(len(c.timers), func(i int) bool {
+		return c.timers[i].when.After(t.when)
+	})
+	c.timers = append(c.timers, nil)
+	copy(c.timers[i+1:], c.timers[i:])
+	c.timers[i] = t
+	return active
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.fn != nil {
+		t.fn()
+		return
+	}
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
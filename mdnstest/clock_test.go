@@ -0,0 +1,95 @@
+package mdnstest_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smartwalle/mdns/mdnstest"
+)
+
+func TestFakeClockFiresInDeadlineOrder(t *testing.T) {
+	var start = time.Unix(0, 0)
+	var clock = mdnstest.NewFakeClock(start)
+	var fired []int
+	for _, d := range []int{3, 1, 2} {
+		var d = d
+		clock.AfterFunc(time.Duration(d)*time.Second, func() {
+			if got := clock.Now(); !got.Equal(start.Add(time.Duration(d) * time.Second)) {
+				t.Errorf("timer %d fired at %v", d, got.Sub(start))
+			}
+			fired = append(fired, d)
+		})
+	}
+
+	if next, ok := clock.Next(); !ok || !next.Equal(start.Add(time.Second)) {
+		t.Fatalf("Next() = %v, %v, want 1s", next.Sub(start), ok)
+	}
+	clock.Advance(1500 * time.Millisecond)
+	if !reflect.DeepEqual(fired, []int{1}) || clock.Pending() != 2 {
+		t.Fatalf("after 1.5s fired %v with %d pending, want [1] with 2", fired, clock.Pending())
+	}
+	clock.Advance(10 * time.Second)
+	if !reflect.DeepEqual(fired, []int{1, 2, 3}) || clock.Pending() != 0 {
+		t.Fatalf("after 11.5s fired %v with %d pending, want [1 2 3] with 0", fired, clock.Pending())
+	}
+	if _, ok := clock.Next(); ok {
+		t.Fatal("Next() reports a timer after all fired")
+	}
+}
+
+func TestFakeClockResetAndStop(t *testing.T) {
+	var clock = mdnstest.NewFakeClock(time.Unix(0, 0))
+	var fired []string
+	var a = clock.AfterFunc(time.Second, func() { fired = append(fired, "a") })
+	var b = clock.AfterFunc(2*time.Second, func() { fired = append(fired, "b") })
+	var c = clock.AfterFunc(3*time.Second, func() { fired = append(fired, "c") })
+
+	if !a.Reset(4 * time.Second) {
+		t.Fatal("Reset of a pending timer returned false")
+	}
+	if !b.Stop() {
+		t.Fatal("Stop of a pending timer returned false")
+	}
+	if b.Stop() {
+		t.Fatal("Stop of a stopped timer returned true")
+	}
+
+	clock.Advance(5 * time.Second)
+	if !reflect.DeepEqual(fired, []string{"c", "a"}) {
+		t.Fatalf("fired %v, want [c a]", fired)
+	}
+	if c.Stop() {
+		t.Fatal("Stop of a fired timer returned true")
+	}
+	if b.Reset(time.Second) {
+		t.Fatal("Reset of a stopped timer returned true")
+	}
+	clock.Advance(time.Second)
+	if !reflect.DeepEqual(fired, []string{"c", "a", "b"}) {
+		t.Fatalf("fired %v after resetting b, want [c a b]", fired)
+	}
+}
+
+func TestFakeClockTimer(t *testing.T) {
+	var start = time.Unix(0, 0)
+	var clock = mdnstest.NewFakeClock(start)
+	var timer = clock.NewTimer(time.Second)
+
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case now := <-timer.C():
+		if !now.Equal(start.Add(time.Second)) {
+			t.Fatalf("timer sent %v, want 1s", now.Sub(start))
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+}
@@ -0,0 +1,308 @@
+package mdnstest
+
+import (
+	"context"
+	"github.com/smartwalle/mdns"
+	"net"
+	"sync"
+)
+
+// Sent is a message sent through a FakeServer.
+type Sent struct {
+	Resource mdns.Resource
+
+	// Dst is the destination passed to SendTo, or nil for Multicast.
+	Dst *net.UDPAddr
+}
+
+// FakeServer is an mdns.Server that records the resources it sends and lets
+// tests inject received packets, so that handlers can be tested without real
+// sockets.
+type FakeServer struct {
+	mu        sync.Mutex
+	ipv4      bool
+	ipv6      bool
+	ttl       int
+	started   bool
+	done      chan struct{}
+	stats     mdns.Stats
+	sent      []Sent
+	qHandler  func(net.Addr, mdns.Question)
+	rHandler  func(net.Addr, mdns.Resource)
+	mHandler  func(net.Addr, mdns.Message)
+	wHandler  func(net.Addr, error)
+	eHandler  func(error)
+	dHandler  func(net.Addr, mdns.DropReason)
+	rcHandler func(mdns.RecoveryEvent)
+
+	// SendErr is returned by SendTo, Multicast and MulticastBatch if not nil.
+	SendErr error
+}
+
+var _ mdns.Server = (*FakeServer)(nil)
+
+// NewFakeServer creates a FakeServer.
+func NewFakeServer() *FakeServer {
+	return &FakeServer{ttl: -1, done: closedChan()}
+}
+
+func (s *FakeServer) EnableIPv4() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ipv4 = true
+}
+
+func (s *FakeServer) EnableIPv6() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ipv6 = true
+}
+
+func (s *FakeServer) SetMulticastTTL(ttl int) error {
+	if ttl > 255 {
+		return mdns.ErrInvalidTTL
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ttl = ttl
+	return nil
+}
+
+func (s *FakeServer) OnQuestion(handler func(net.Addr, mdns.Question)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.qHandler = handler
+}
+
+func (s *FakeServer) OnResource(handler func(net.Addr, mdns.Resource)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rHandler = handler
+}
+
+func (s *FakeServer) OnMessage(handler func(net.Addr, mdns.Message)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mHandler = handler
+}
+
+func (s *FakeServer) OnWarning(handler func(net.Addr, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wHandler = handler
+}
+
+func (s *FakeServer) OnError(handler func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eHandler = handler
+}
+
+func (s *FakeServer) OnDrop(handler func(net.Addr, mdns.DropReason)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dHandler = handler
+}
+
+func (s *FakeServer) OnRecovery(handler func(mdns.RecoveryEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rcHandler = handler
+}
+
+func (s *FakeServer) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return mdns.ErrAlreadyStarted
+	}
+	s.started = true
+	s.done = make(chan struct{})
+	return nil
+}
+
+func (s *FakeServer) SendTo(resource mdns.Resource, dst *net.UDPAddr) error {
+	return s.record(Sent{Resource: resource, Dst: dst})
+}
+
+func (s *FakeServer) Multicast(resource mdns.Resource) error {
+	return s.record(Sent{Resource: resource})
+}
+
+func (s *FakeServer) MulticastBatch(resources ...mdns.Resource) error {
+	var sent = make([]Sent, 0, len(resources))
+	for _, resource := range resources {
+		sent = append(sent, Sent{Resource: resource})
+	}
+	return s.record(sent...)
+}
+
+func (s *FakeServer) record(sent ...Sent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.SendErr != nil {
+		return s.SendErr
+	}
+	s.sent = append(s.sent, sent...)
+	return nil
+}
+
+func (s *FakeServer) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		s.started = false
+		close(s.done)
+	}
+	return nil
+}
+
+func (s *FakeServer) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+func (s *FakeServer) Wait() {
+	<-s.Done()
+}
+
+// Stats returns the counters set with SetStats.
+func (s *FakeServer) Stats() mdns.Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// SetStats sets the counters returned by Stats.
+func (s *FakeServer) SetStats(stats mdns.Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = stats
+}
+
+// Started reports whether Start was called and Stop was not called since.
+func (s *FakeServer) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// MulticastTTL returns the TTL set with SetMulticastTTL, or -1.
+func (s *FakeServer) MulticastTTL() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ttl
+}
+
+// Sent returns every message sent so far, in order.
+func (s *FakeServer) Sent() []Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Sent(nil), s.sent...)
+}
+
+// Resources returns the resources of every message sent so far, in order.
+func (s *FakeServer) Resources() []mdns.Resource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var resources = make([]mdns.Resource, 0, len(s.sent))
+	for _, sent := range s.sent {
+		resources = append(resources, sent.Resource)
+	}
+	return resources
+}
+
+// Reset forgets every message sent so far.
+func (s *FakeServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = nil
+}
+
+// ReceiveQuestion calls the handlers as if question was received from src:
+// the OnMessage handler, then the OnQuestion handler.
+func (s *FakeServer) ReceiveQuestion(src net.Addr, question mdns.Question) {
+	s.ReceiveMessage(src, mdns.Message{Header: question.Header, Questions: question.Questions})
+}
+
+// ReceiveResource calls the handlers as if resource was received from src:
+// the OnMessage handler, then the OnResource handler.
+func (s *FakeServer) ReceiveResource(src net.Addr, resource mdns.Resource) {
+	s.ReceiveMessage(src, mdns.Message{
+		Header:      resource.Header,
+		Answers:     resource.Answers,
+		Authorities: resource.Authorities,
+		Additionals: resource.Additionals,
+	})
+}
+
+// ReceiveMessage calls the handlers as if message was received from src, like
+// a Server does: the OnMessage handler, then the OnQuestion handler if
+// message has questions and the OnResource handler if it has records.
+func (s *FakeServer) ReceiveMessage(src net.Addr, message mdns.Message) {
+	s.mu.Lock()
+	var qHandler, rHandler, mHandler = s.qHandler, s.rHandler, s.mHandler
+	s.mu.Unlock()
+
+	if mHandler != nil {
+		mHandler(src, message)
+	}
+	if qHandler != nil && len(message.Questions) > 0 {
+		qHandler(src, mdns.Question{Header: message.Header, Questions: message.Questions})
+	}
+	if rHandler != nil && (len(message.Answers) > 0 || len(message.Authorities) > 0 || len(message.Additionals) > 0) {
+		rHandler(src, mdns.Resource{
+			Header:      message.Header,
+			Answers:     message.Answers,
+			Authorities: message.Authorities,
+			Additionals: message.Additionals,
+		})
+	}
+}
+
+// Warn calls the OnWarning handler with src and err.
+func (s *FakeServer) Warn(src net.Addr, err error) {
+	s.mu.Lock()
+	var handler = s.wHandler
+	s.mu.Unlock()
+	if handler != nil {
+		handler(src, err)
+	}
+}
+
+// Fail calls the OnError handler with err.
+func (s *FakeServer) Fail(err error) {
+	s.mu.Lock()
+	var handler = s.eHandler
+	s.mu.Unlock()
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// Recover calls the OnRecovery handler with event.
+func (s *FakeServer) Recover(event mdns.RecoveryEvent) {
+	s.mu.Lock()
+	var handler = s.rcHandler
+	s.mu.Unlock()
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// Drop calls the OnDrop handler with src and reason.
+func (s *FakeServer) Drop(src net.Addr, reason mdns.DropReason) {
+	s.mu.Lock()
+	var handler = s.dHandler
+	s.mu.Unlock()
+	if handler != nil {
+		handler(src, reason)
+	}
+}
+
+func closedChan() chan struct{} {
+	var ch = make(chan struct{})
+	close(ch)
+	return ch
+}
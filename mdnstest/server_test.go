@@ -0,0 +1,40 @@
+package mdnstest_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/smartwalle/mdns"
+	"github.com/smartwalle/mdns/mdnstest"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestServeThroughReceiveQuestion(t *testing.T) {
+	var name = dnsmessage.MustNewName("printer.local.")
+	var mux = mdns.NewServeMux()
+	mux.HandleFunc("printer.local.", dnsmessage.TypeA, func(w mdns.ResponseWriter, r *mdns.Request) {
+		w.Answer(dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 120},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		})
+	})
+
+	var server = mdnstest.NewFakeServer()
+	mdns.Serve(server, mux)
+	var questions int
+	server.OnQuestion(func(net.Addr, mdns.Question) {
+		questions++
+	})
+
+	server.ReceiveQuestion(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: mdns.Port}, mdns.Question{
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	})
+
+	if questions != 1 {
+		t.Errorf("OnQuestion called %d times, want 1", questions)
+	}
+	var sent = server.Sent()
+	if len(sent) != 1 || sent[0].Dst != nil || len(sent[0].Resource.Answers) != 1 {
+		t.Fatalf("sent %+v, want one multicast answer", sent)
+	}
+}
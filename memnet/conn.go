@@ -0,0 +1,205 @@
+package memnet
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// queueSize is the number of packets a conn buffers before dropping, like a
+// full socket receive buffer.
+const queueSize = 256
+
+type packet struct {
+	data []byte
+	src  *net.UDPAddr
+}
+
+type membership struct {
+	index int
+	group string
+}
+
+// conn is a packet connection bound on a simulated host.
+type conn struct {
+	host     *Host
+	network  string
+	laddr    *net.UDPAddr
+	queue    chan packet
+	closed   chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	groups   map[membership]struct{}
+	loopback bool
+	ttl      int
+	deadline time.Time
+}
+
+func newConn(host *Host, network string, laddr *net.UDPAddr) *conn {
+	return &conn{
+		host:     host,
+		network:  network,
+		laddr:    laddr,
+		queue:    make(chan packet, queueSize),
+		closed:   make(chan struct{}),
+		groups:   make(map[membership]struct{}),
+		loopback: true,
+		ttl:      1,
+	}
+}
+
+// accepts reports whether c receives a packet addressed to dst arriving on
+// iface.
+func (c *conn) accepts(iface *Interface, dst *net.UDPAddr) bool {
+	if c.laddr.Port != dst.Port || (c.network == "udp4") != (dst.IP.To4() != nil) {
+		return false
+	}
+
+	if dst.IP.IsMulticast() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if _, ok := c.groups[membership{index: iface.iface.Index, group: dst.IP.String()}]; !ok {
+			return false
+		}
+		return c.wildcard()
+	}
+	return c.wildcard() || c.laddr.IP.Equal(dst.IP)
+}
+
+// wildcard reports whether c receives packets for every address of its host.
+// Like the net package, which binds a multicast address as the wildcard, a
+// conn bound to a multicast address also receives unicast.
+func (c *conn) wildcard() bool {
+	return c.laddr.IP == nil || c.laddr.IP.IsUnspecified() || c.laddr.IP.IsMulticast()
+}
+
+func (c *conn) deliver(b []byte, src *net.UDPAddr) {
+	var nPacket = packet{data: append([]byte(nil), b...), src: src}
+	select {
+	case c.queue <- nPacket:
+	default:
+	}
+}
+
+func (c *conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	var deadline = c.deadline
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		var timer = time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case nPacket := <-c.queue:
+		return copy(b, nPacket.data), nPacket.src, nil
+	case <-c.closed:
+		return 0, nil, c.opError("read", net.ErrClosed)
+	case <-timeout:
+		return 0, nil, c.opError("read", errTimeout{})
+	}
+}
+
+func (c *conn) WriteTo(b []byte, dst net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, c.opError("write", net.ErrClosed)
+	default:
+	}
+
+	var uDst, ok = dst.(*net.UDPAddr)
+	if !ok {
+		return 0, c.opError("write", net.InvalidAddrError("not a UDP address"))
+	}
+	c.host.network.send(c, b, uDst)
+	return len(b), nil
+}
+
+func (c *conn) Close() error {
+	var closed = false
+	c.once.Do(func() {
+		closed = true
+		close(c.closed)
+		c.host.network.mu.Lock()
+		delete(c.host.conns, c)
+		c.host.network.mu.Unlock()
+	})
+	if !closed {
+		return c.opError("close", net.ErrClosed)
+	}
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *conn) JoinGroup(iface *net.Interface, group net.Addr) error {
+	var ip net.IP
+	switch addr := group.(type) {
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.IPAddr:
+		ip = addr.IP
+	}
+	if ip == nil || !ip.IsMulticast() {
+		return c.opError("join", net.InvalidAddrError("not a multicast group"))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.groups[membership{index: iface.Index, group: ip.String()}] = struct{}{}
+	return nil
+}
+
+func (c *conn) SetMulticastTTL(ttl int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+	return nil
+}
+
+func (c *conn) SetMulticastLoopback(on bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loopback = on
+	return nil
+}
+
+func (c *conn) multicastLoopback() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.loopback
+}
+
+func (c *conn) SetReadBuffer(bytes int) error {
+	return nil
+}
+
+func (c *conn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: c.network, Source: c.laddr, Err: err}
+}
+
+type errTimeout struct{}
+
+func (errTimeout) Error() string   { return "i/o timeout" }
+func (errTimeout) Timeout() bool   { return true }
+func (errTimeout) Temporary() bool { return true }
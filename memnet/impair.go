@@ -0,0 +1,158 @@
+package memnet
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Delay is a distribution of one-way packet delays.
+type Delay interface {
+	Next(r *rand.Rand) time.Duration
+}
+
+// DelayFunc adapts a function to the Delay interface.
+type DelayFunc func(r *rand.Rand) time.Duration
+
+func (f DelayFunc) Next(r *rand.Rand) time.Duration {
+	return f(r)
+}
+
+// FixedDelay delays every packet by d.
+func FixedDelay(d time.Duration) Delay {
+	return DelayFunc(func(r *rand.Rand) time.Duration {
+		return d
+	})
+}
+
+// UniformDelay delays packets by a duration drawn uniformly from [min, max].
+func UniformDelay(min, max time.Duration) Delay {
+	return DelayFunc(func(r *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(r.Int63n(int64(max-min)+1))
+	})
+}
+
+// NormalDelay delays packets by a normally distributed duration with the
+// given mean and standard deviation, never less than zero.
+func NormalDelay(mean, stddev time.Duration) Delay {
+	return DelayFunc(func(r *rand.Rand) time.Duration {
+		var d = mean + time.Duration(r.NormFloat64()*float64(stddev))
+		if d < 0 {
+			return 0
+		}
+		return d
+	})
+}
+
+// Impairment describes how a link degrades the packets crossing it. Every
+// receiving interface draws its own outcome, so a multicast packet may reach
+// some hosts and not others.
+type Impairment struct {
+	// Loss is the probability that a packet is dropped.
+	Loss float64
+
+	// Duplicate is the probability that a packet is delivered twice.
+	Duplicate float64
+
+	// Delay is the distribution of the one-way delay. A nil Delay delivers
+	// packets immediately.
+	Delay Delay
+
+	// Reorder is the probability that a packet is held back by ReorderDelay
+	// on top of its normal delay, letting later packets overtake it.
+	Reorder float64
+
+	// ReorderDelay is the extra delay of reordered packets.
+	ReorderDelay time.Duration
+}
+
+// SetImpairment sets the impairment of l. The zero Impairment delivers every
+// packet once and immediately.
+func (l *Link) SetImpairment(impairment Impairment) {
+	l.network.mu.Lock()
+	defer l.network.mu.Unlock()
+	l.impairment = impairment
+}
+
+// delays returns the delay of every copy of a packet crossing l; an empty
+// result means the packet is lost. It must be called with the network lock
+// held so that the draws follow the order of the packets.
+func (l *Link) delays(r *rand.Rand) []time.Duration {
+	var impairment = l.impairment
+	if impairment.Loss > 0 && r.Float64() < impairment.Loss {
+		return nil
+	}
+
+	var copies = 1
+	if impairment.Duplicate > 0 && r.Float64() < impairment.Duplicate {
+		copies = 2
+	}
+
+	var delays = make([]time.Duration, 0, copies)
+	for i := 0; i < copies; i++ {
+		var d time.Duration
+		if impairment.Delay != nil {
+			d = impairment.Delay.Next(r)
+		}
+		if impairment.Reorder > 0 && r.Float64() < impairment.Reorder {
+			d += impairment.ReorderDelay
+		}
+		delays = append(delays, d)
+	}
+	return delays
+}
+
+type hostPair struct {
+	a, b *Host
+}
+
+func pairOf(a, b *Host) hostPair {
+	if a.id > b.id {
+		a, b = b, a
+	}
+	return hostPair{a: a, b: b}
+}
+
+// Partition stops all packets between a and b in both directions until
+// Heal is called.
+func (n *Network) Partition(a, b *Host) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partitions[pairOf(a, b)] = struct{}{}
+}
+
+// Heal lets packets flow between a and b again.
+func (n *Network) Heal(a, b *Host) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.partitions, pairOf(a, b))
+}
+
+// HealAll removes every partition.
+func (n *Network) HealAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partitions = make(map[hostPair]struct{})
+}
+
+func (n *Network) partitioned(a, b *Host) bool {
+	if a == b {
+		return false
+	}
+	_, ok := n.partitions[pairOf(a, b)]
+	return ok
+}
+
+// after calls f after d on the network clock, or right away if d is zero.
+func (n *Network) after(d time.Duration, f func()) {
+	switch {
+	case d <= 0:
+		f()
+	case n.clock != nil:
+		n.clock.AfterFunc(d, f)
+	default:
+		time.AfterFunc(d, f)
+	}
+}
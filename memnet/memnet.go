@@ -0,0 +1,269 @@
+// Package memnet provides an in-memory network of simulated hosts that can be
+// used as the mdns.Transport of a Client or Server. It lets many peers run
+// discovery scenarios in one process without sockets, root privileges or a
+// real network.
+//
+//	var network = memnet.NewNetwork()
+//	var lan = network.NewLink("lan")
+//	var host = network.NewHost("host1")
+//	host.AddInterface("eth0", lan, net.ParseIP("192.168.1.10"), net.ParseIP("fe80::10"))
+//
+//	var server = mdns.NewServer(mdns.WithTransport(host))
+package memnet
+
+import (
+	"fmt"
+	"github.com/smartwalle/mdns"
+	"math/rand"
+	"net"
+	"sync"
+)
+
+// Network is a set of links and the hosts attached to them.
+type Network struct {
+	mu         sync.Mutex
+	hosts      []*Host
+	rand       *rand.Rand
+	clock      mdns.Clock
+	partitions map[hostPair]struct{}
+}
+
+// Option configures a Network created by NewNetwork.
+type Option func(n *Network)
+
+// WithSeed seeds the random source behind every impairment, so that a
+// scenario sending the same packets in the same order sees the same losses,
+// duplicates and delays.
+func WithSeed(seed int64) Option {
+	return func(n *Network) {
+		n.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithClock sets the clock used to deliver delayed packets. Pass the same
+// clock to the clients and servers of the scenario to control time.
+func WithClock(clock mdns.Clock) Option {
+	return func(n *Network) {
+		n.clock = clock
+	}
+}
+
+// NewNetwork creates an empty network.
+func NewNetwork(opts ...Option) *Network {
+	var n = &Network{
+		rand:       rand.New(rand.NewSource(1)),
+		partitions: make(map[hostPair]struct{}),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(n)
+		}
+	}
+	return n
+}
+
+// Link is a simulated layer 2 segment. Multicast packets sent on a link are
+// delivered to every interface attached to it.
+type Link struct {
+	network    *Network
+	name       string
+	ifaces     []*Interface
+	impairment Impairment
+}
+
+// NewLink creates a link named name.
+func (n *Network) NewLink(name string) *Link {
+	return &Link{network: n, name: name}
+}
+
+func (l *Link) String() string {
+	return l.name
+}
+
+// Host is a simulated host. It implements mdns.Transport, so it can be passed
+// to WithTransport.
+type Host struct {
+	network  *Network
+	id       int
+	name     string
+	ifaces   []*Interface
+	conns    map[*conn]struct{}
+	nextPort int
+}
+
+var _ mdns.Transport = (*Host)(nil)
+
+// NewHost creates a host named name without interfaces.
+func (n *Network) NewHost(name string) *Host {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var host = &Host{
+		network:  n,
+		id:       len(n.hosts),
+		name:     name,
+		conns:    make(map[*conn]struct{}),
+		nextPort: 49152,
+	}
+	n.hosts = append(n.hosts, host)
+	return host
+}
+
+func (h *Host) String() string {
+	return h.name
+}
+
+// Interface is a network interface of a host attached to a link.
+type Interface struct {
+	host  *Host
+	link  *Link
+	iface net.Interface
+	addrs []net.IP
+}
+
+// AddInterface attaches h to link through a new interface named name with the
+// given addresses.
+func (h *Host) AddInterface(name string, link *Link, addrs ...net.IP) *Interface {
+	h.network.mu.Lock()
+	defer h.network.mu.Unlock()
+
+	var index = len(h.ifaces) + 1
+	var nIface = &Interface{
+		host: h,
+		link: link,
+		iface: net.Interface{
+			Index:        index,
+			MTU:          1500,
+			Name:         name,
+			HardwareAddr: net.HardwareAddr{0x02, 0, 0, byte(len(h.network.hosts)), 0, byte(index)},
+			Flags:        net.FlagUp | net.FlagBroadcast | net.FlagMulticast,
+		},
+		addrs: addrs,
+	}
+	h.ifaces = append(h.ifaces, nIface)
+	link.ifaces = append(link.ifaces, nIface)
+	return nIface
+}
+
+// Interfaces implements mdns.Transport.
+func (h *Host) Interfaces() ([]net.Interface, error) {
+	h.network.mu.Lock()
+	defer h.network.mu.Unlock()
+
+	var ifaces = make([]net.Interface, 0, len(h.ifaces))
+	for _, iface := range h.ifaces {
+		ifaces = append(ifaces, iface.iface)
+	}
+	return ifaces, nil
+}
+
+// InterfaceAddrs returns the addresses of every interface of h. The mdns
+// package uses it to recognize the packets a host sent itself.
+func (h *Host) InterfaceAddrs() ([]net.Addr, error) {
+	h.network.mu.Lock()
+	defer h.network.mu.Unlock()
+
+	var addrs []net.Addr
+	for _, iface := range h.ifaces {
+		for _, ip := range iface.addrs {
+			addrs = append(addrs, &net.IPAddr{IP: ip})
+		}
+	}
+	return addrs, nil
+}
+
+// ListenPacket implements mdns.Transport.
+func (h *Host) ListenPacket(network string, addr *net.UDPAddr) (mdns.PacketConn, error) {
+	if network != "udp4" && network != "udp6" {
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	h.network.mu.Lock()
+	defer h.network.mu.Unlock()
+
+	var laddr = &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone}
+	if laddr.Port == 0 {
+		laddr.Port = h.nextPort
+		h.nextPort++
+	}
+	if laddr.IP != nil && !laddr.IP.IsUnspecified() && !laddr.IP.IsMulticast() && h.ifaceFor(laddr.IP) == nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Addr: laddr, Err: fmt.Errorf("address not available on host %s", h.name)}
+	}
+
+	var nConn = newConn(h, network, laddr)
+	h.conns[nConn] = struct{}{}
+	return nConn, nil
+}
+
+// ifaceFor returns the interface of h owning ip.
+func (h *Host) ifaceFor(ip net.IP) *Interface {
+	for _, iface := range h.ifaces {
+		for _, addr := range iface.addrs {
+			if addr.Equal(ip) {
+				return iface
+			}
+		}
+	}
+	return nil
+}
+
+// source returns the address of iface to send from for network.
+func (i *Interface) source(network string) (net.IP, bool) {
+	for _, addr := range i.addrs {
+		if (addr.To4() != nil) == (network == "udp4") {
+			return addr, true
+		}
+	}
+	return nil, false
+}
+
+// send delivers b from c to dst. Multicast packets are sent on every link
+// the host is attached to; unicast packets on the link holding dst.
+func (n *Network) send(c *conn, b []byte, dst *net.UDPAddr) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var data = append([]byte(nil), b...)
+	for _, iface := range c.host.ifaces {
+		var src, ok = iface.source(c.network)
+		if !ok {
+			continue
+		}
+		if c.laddr.IP != nil && !c.laddr.IP.IsUnspecified() && !c.laddr.IP.IsMulticast() && !c.laddr.IP.Equal(src) {
+			continue
+		}
+
+		for _, peer := range iface.link.ifaces {
+			if peer.host == c.host && dst.IP.IsMulticast() && !c.multicastLoopback() {
+				continue
+			}
+			if !dst.IP.IsMulticast() && peer.host.ifaceFor(dst.IP) != peer {
+				continue
+			}
+			if n.partitioned(c.host, peer.host) {
+				continue
+			}
+
+			var from = &net.UDPAddr{IP: src, Port: c.laddr.Port}
+			if src.IsLinkLocalUnicast() && src.To4() == nil {
+				from.Zone = peer.iface.Name
+			}
+			var receivers []*conn
+			for receiver := range peer.host.conns {
+				if receiver.accepts(peer, dst) {
+					receivers = append(receivers, receiver)
+				}
+			}
+			if len(receivers) == 0 {
+				continue
+			}
+			for _, d := range iface.link.delays(n.rand) {
+				n.after(d, func() {
+					for _, receiver := range receivers {
+						receiver.deliver(data, from)
+					}
+				})
+			}
+		}
+	}
+}
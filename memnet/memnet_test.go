@@ -0,0 +1,251 @@
+package memnet_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smartwalle/mdns"
+	"github.com/smartwalle/mdns/mdnstest"
+	"github.com/smartwalle/mdns/memnet"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type pair struct {
+	network  *memnet.Network
+	link     *memnet.Link
+	a, b     *memnet.Host
+	sender   mdns.PacketConn
+	receiver mdns.PacketConn
+	dst      *net.UDPAddr
+}
+
+func newPair(t *testing.T, opts ...memnet.Option) *pair {
+	t.Helper()
+	var p = &pair{network: memnet.NewNetwork(opts...)}
+	p.link = p.network.NewLink("lan")
+	p.a = p.network.NewHost("a")
+	p.a.AddInterface("eth0", p.link, net.IPv4(192, 0, 2, 1))
+	p.b = p.network.NewHost("b")
+	p.b.AddInterface("eth0", p.link, net.IPv4(192, 0, 2, 2))
+
+	var err error
+	if p.sender, err = p.a.ListenPacket("udp4", &net.UDPAddr{}); err != nil {
+		t.Fatal(err)
+	}
+	p.dst = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 9999}
+	if p.receiver, err = p.b.ListenPacket("udp4", &net.UDPAddr{Port: p.dst.Port}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		p.sender.Close()
+		p.receiver.Close()
+	})
+	return p
+}
+
+// send sends packets numbered from 0 to n-1.
+func (p *pair) send(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := p.sender.WriteTo([]byte{byte(i)}, p.dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// received returns the numbers of the packets waiting at the receiver, in
+// the order they arrived.
+func (p *pair) received(t *testing.T) []int {
+	t.Helper()
+	var got []int
+	var b = make([]byte, 16)
+	for {
+		_ = p.receiver.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+		n, _, err := p.receiver.ReadFrom(b)
+		if err != nil {
+			return got
+		}
+		if n != 1 {
+			t.Fatalf("received %d bytes, want 1", n)
+		}
+		got = append(got, int(b[0]))
+	}
+}
+
+// impairedRun sends 200 packets over an impaired link and returns the order
+// in which they arrived.
+func impairedRun(t *testing.T, seed int64) []int {
+	var clock = mdnstest.NewFakeClock(time.Unix(0, 0))
+	var p = newPair(t, memnet.WithSeed(seed), memnet.WithClock(clock))
+	p.link.SetImpairment(memnet.Impairment{
+		Loss:         0.2,
+		Duplicate:    0.2,
+		Delay:        memnet.UniformDelay(time.Millisecond, 5*time.Millisecond),
+		Reorder:      0.2,
+		ReorderDelay: 50 * time.Millisecond,
+	})
+
+	// The receive queue holds 256 packets; send in rounds so none overflow.
+	var got []int
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 100; i++ {
+			if _, err := p.sender.WriteTo([]byte{byte(round*100 + i)}, p.dst); err != nil {
+				t.Fatal(err)
+			}
+			clock.Advance(time.Millisecond)
+		}
+		clock.Advance(time.Second)
+		got = append(got, p.received(t)...)
+	}
+	return got
+}
+
+func TestImpairmentDeterministic(t *testing.T) {
+	var first = impairedRun(t, 7)
+	if second := impairedRun(t, 7); !reflect.DeepEqual(first, second) {
+		t.Fatalf("runs with the same seed differ:\n%v\n%v", first, second)
+	}
+	if other := impairedRun(t, 8); reflect.DeepEqual(first, other) {
+		t.Fatal("runs with different seeds are identical")
+	}
+
+	var counts = make(map[int]int)
+	var reordered bool
+	for i, n := range first {
+		counts[n]++
+		reordered = reordered || (i > 0 && n < first[i-1])
+	}
+	var lost, duplicated int
+	for i := 0; i < 200; i++ {
+		switch counts[i] {
+		case 0:
+			lost++
+		case 2:
+			duplicated++
+		}
+	}
+	if lost == 0 || duplicated == 0 || !reordered {
+		t.Fatalf("lost %d, duplicated %d, reordered %v: want every impairment", lost, duplicated, reordered)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	var p = newPair(t)
+
+	p.network.Partition(p.a, p.b)
+	p.send(t, 3)
+	if got := p.received(t); len(got) != 0 {
+		t.Fatalf("received %v across a partition", got)
+	}
+
+	p.network.Heal(p.a, p.b)
+	p.send(t, 3)
+	if got := p.received(t); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Fatalf("received %v after healing, want [0 1 2]", got)
+	}
+
+	p.network.Partition(p.b, p.a)
+	p.network.HealAll()
+	p.send(t, 1)
+	if got := p.received(t); len(got) != 1 {
+		t.Fatalf("received %v after HealAll, want one packet", got)
+	}
+}
+
+func TestUnicastToMulticastBind(t *testing.T) {
+	var network = memnet.NewNetwork()
+	var lan = network.NewLink("lan")
+	var serverHost = network.NewHost("server")
+	serverHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 1))
+	var clientHost = network.NewHost("client")
+	clientHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 2))
+
+	var name = dnsmessage.MustNewName("printer.local.")
+	var mux = mdns.NewServeMux()
+	mux.HandleFunc(name.String(), dnsmessage.TypeA, func(w mdns.ResponseWriter, r *mdns.Request) {
+		w.Answer(dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 120},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		})
+	})
+
+	// The server binds to 224.0.0.0, the default.
+	var server = mdns.NewServer(mdns.WithTransport(serverHost))
+	server.EnableIPv4()
+	mdns.Serve(server, mux)
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop(context.Background())
+
+	t.Run("legacy", func(t *testing.T) {
+		var resolver, err = clientHost.ListenPacket("udp4", &net.UDPAddr{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resolver.Close()
+
+		var query = dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: 7},
+			Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+		}
+		b, err := query.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = resolver.WriteTo(b, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: mdns.Port}); err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resolver.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var reply = make([]byte, 9000)
+		n, _, err := resolver.ReadFrom(reply)
+		if err != nil {
+			t.Fatalf("no reply to a unicast query: %v", err)
+		}
+		var message dnsmessage.Message
+		if err = message.Unpack(reply[:n]); err != nil {
+			t.Fatal(err)
+		}
+		if message.Header.ID != 7 || len(message.Answers) != 1 {
+			t.Fatalf("reply has ID %d and %d answers, want 7 and 1", message.Header.ID, len(message.Answers))
+		}
+	})
+
+	t.Run("QU", func(t *testing.T) {
+		// The continuous client also binds to 224.0.0.0.
+		var client = mdns.NewClient(mdns.WithTransport(clientHost), mdns.WithContinuousQuerying())
+		client.EnableIPv4()
+		var received = make(chan net.Addr, 1)
+		client.OnResource(func(addr net.Addr, resource mdns.Resource) {
+			if len(resource.Answers) > 0 {
+				select {
+				case received <- addr:
+				default:
+				}
+			}
+		})
+		if err := client.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer client.Stop(context.Background())
+
+		var err = client.Send(mdns.Question{
+			Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET | 1<<15}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case addr := <-received:
+			if !addr.(*net.UDPAddr).IP.Equal(net.IPv4(192, 0, 2, 1)) {
+				t.Fatalf("response from %v, want the server", addr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the QU response did not reach the client")
+		}
+	})
+}
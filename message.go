@@ -4,6 +4,7 @@ import (
 	"golang.org/x/net/dns/dnsmessage"
 	"math/big"
 	"net"
+	"time"
 )
 
 func MustName(name string) dnsmessage.Name {
@@ -57,3 +58,41 @@ type Resource struct {
 	Additionals []dnsmessage.Resource
 	Header      dnsmessage.Header
 }
+
+// Message is a complete received message: the header, all four sections and
+// information about the packet it arrived in. Unlike Question and Resource it
+// keeps the known answers of a query and the authority records of a probe
+// together with the questions.
+type Message struct {
+	Header      dnsmessage.Header
+	Questions   []dnsmessage.Question
+	Answers     []dnsmessage.Resource
+	Authorities []dnsmessage.Resource
+	Additionals []dnsmessage.Resource
+
+	// Size is the length of the packet in bytes.
+	Size int
+
+	// ReceivedAt is when the packet was received, according to the Clock.
+	ReceivedAt time.Time
+
+	// HopLimit is the IP TTL (IPv4) or hop limit (IPv6) of the packet, and
+	// IfIndex the index of the interface it arrived on. Both are zero unless
+	// ValidateHopLimit or ValidateSourceAddress is enabled and the transport
+	// reports them.
+	HopLimit int
+	IfIndex  int
+
+	// Own is set if the packet was sent by a Client or Server of this
+	// process and looped back. See WithOwnPackets.
+	Own bool
+
+	// Addrs holds every address the message arrived from, starting with the
+	// one passed to the handlers, if copies of it were merged by
+	// WithDeduplication. It is nil otherwise.
+	Addrs []net.Addr
+
+	// Malformed is set in ParseLenient mode if part of the packet could not
+	// be parsed. The sections then only hold the records parsed before it.
+	Malformed *ParseError
+}
@@ -0,0 +1,50 @@
+package mdns
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+)
+
+// Inbound handles a message received from src.
+type Inbound func(src net.Addr, message Message)
+
+// InboundMiddleware wraps the handling of received messages. It may inspect or
+// modify message before passing it to next, or drop it by not calling next.
+type InboundMiddleware func(next Inbound) Inbound
+
+// Outbound sends message to dst, or multicasts it if dst is nil.
+type Outbound func(message dnsmessage.Message, dst *net.UDPAddr) error
+
+// OutboundMiddleware wraps the sending of messages. It may inspect or modify
+// message before passing it to next, or drop it by returning without calling
+// next.
+//
+// For the messages of a MulticastBatch, next only queues the message and
+// returns nil; the batch is sent once every message has passed through the
+// middleware, and its error is returned by MulticastBatch.
+type OutboundMiddleware func(next Outbound) Outbound
+
+// buildChains composes the middleware of m. It is called again once the
+// options have been applied.
+func (m *mDNS) buildChains() {
+	m.inbound = chainInbound(m.inMiddleware, m.deliver)
+	m.outbound = chainOutbound(m.outMiddleware, m.send)
+}
+
+func chainInbound(middleware []InboundMiddleware, last Inbound) Inbound {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		if middleware[i] != nil {
+			last = middleware[i](last)
+		}
+	}
+	return last
+}
+
+func chainOutbound(middleware []OutboundMiddleware, last Outbound) Outbound {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		if middleware[i] != nil {
+			last = middleware[i](last)
+		}
+	}
+	return last
+}
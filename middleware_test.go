@@ -0,0 +1,221 @@
+package mdns_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartwalle/mdns"
+	"github.com/smartwalle/mdns/memnet"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// middlewareScenario is a server on a memnet host and a peer on another host
+// that has joined the mDNS group.
+type middlewareScenario struct {
+	server mdns.Server
+	peer   mdns.PacketConn
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func newMiddlewareScenario(t *testing.T, opts ...mdns.ServerOption) *middlewareScenario {
+	var network = memnet.NewNetwork()
+	var lan = network.NewLink("lan")
+	var serverHost = network.NewHost("server")
+	serverHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 1))
+	var peerHost = network.NewHost("peer")
+	peerHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 2))
+
+	var s = &middlewareScenario{}
+	s.server = mdns.NewServer(append([]mdns.ServerOption{mdns.WithTransport(serverHost)}, opts...)...)
+	s.server.EnableIPv4()
+	if err := s.server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.server.Stop(context.Background()) })
+
+	var err error
+	if s.peer, err = peerHost.ListenPacket("udp4", &net.UDPAddr{Port: mdns.Port}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.peer.Close() })
+	var ifaces, _ = peerHost.Interfaces()
+	if err = s.peer.JoinGroup(&ifaces[0], &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251)}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (s *middlewareScenario) call(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, name)
+}
+
+func (s *middlewareScenario) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+func (s *middlewareScenario) called() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// query sends a query with the given ID from the peer to the server.
+func (s *middlewareScenario) query(t *testing.T, id uint16) {
+	t.Helper()
+	var data, err = (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("printer.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.peer.WriteTo(data, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: mdns.Port}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receive returns the messages received by the peer until none arrives for a
+// while.
+func (s *middlewareScenario) receive(t *testing.T) []dnsmessage.Message {
+	t.Helper()
+	var messages []dnsmessage.Message
+	var b = make([]byte, 9000)
+	for {
+		_ = s.peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		n, _, err := s.peer.ReadFrom(b)
+		if err != nil {
+			return messages
+		}
+		var message dnsmessage.Message
+		if err = message.Unpack(b[:n]); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, message)
+	}
+}
+
+// waitCalls waits until the calls recorded match want.
+func (s *middlewareScenario) waitCalls(t *testing.T, want []string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !reflect.DeepEqual(s.called(), want); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("called %v, want %v", s.called(), want)
+		}
+	}
+}
+
+func TestInboundMiddleware(t *testing.T) {
+	var s *middlewareScenario
+	var record = func(name string) mdns.InboundMiddleware {
+		return func(next mdns.Inbound) mdns.Inbound {
+			return func(src net.Addr, message mdns.Message) {
+				s.call(name)
+				next(src, message)
+			}
+		}
+	}
+	var dropOdd = func(next mdns.Inbound) mdns.Inbound {
+		return func(src net.Addr, message mdns.Message) {
+			if message.Header.ID%2 == 1 {
+				s.call("dropped")
+				return
+			}
+			next(src, message)
+		}
+	}
+	s = newMiddlewareScenario(t, mdns.WithInbound(record("first"), record("second")), mdns.WithInbound(dropOdd))
+	s.server.OnMessage(func(net.Addr, mdns.Message) {
+		s.call("handler")
+	})
+
+	s.query(t, 2)
+	s.waitCalls(t, []string{"first", "second", "handler"})
+	s.query(t, 1)
+	s.waitCalls(t, []string{"first", "second", "handler", "first", "second", "dropped"})
+}
+
+func announcement(name string) mdns.Resource {
+	return mdns.Resource{
+		Header: dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 120},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		}},
+	}
+}
+
+func TestOutboundMiddleware(t *testing.T) {
+	var s *middlewareScenario
+	var record = func(name string) mdns.OutboundMiddleware {
+		return func(next mdns.Outbound) mdns.Outbound {
+			return func(message dnsmessage.Message, dst *net.UDPAddr) error {
+				s.call(name)
+				return next(message, dst)
+			}
+		}
+	}
+	// filter drops the announcements of drop.local. and lowers the TTL of
+	// the others.
+	var filter = func(next mdns.Outbound) mdns.Outbound {
+		return func(message dnsmessage.Message, dst *net.UDPAddr) error {
+			if message.Answers[0].Header.Name.String() == "drop.local." {
+				return nil
+			}
+			message.Answers[0].Header.TTL = 60
+			return next(message, dst)
+		}
+	}
+	s = newMiddlewareScenario(t, mdns.WithOutbound(record("first"), record("second"), filter))
+
+	t.Run("Multicast", func(t *testing.T) {
+		if err := s.server.Multicast(announcement("one.local.")); err != nil {
+			t.Fatal(err)
+		}
+		var messages = s.receive(t)
+		if len(messages) != 1 || messages[0].Answers[0].Header.TTL != 60 {
+			t.Fatalf("peer received %v, want one announcement with TTL 60", messages)
+		}
+		s.waitCalls(t, []string{"first", "second"})
+	})
+
+	t.Run("MulticastBatch", func(t *testing.T) {
+		s.reset()
+		var err = s.server.MulticastBatch(announcement("one.local."), announcement("drop.local."), announcement("two.local."))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, message := range s.receive(t) {
+			if message.Answers[0].Header.TTL != 60 {
+				t.Errorf("%v announced with TTL %d, want 60", message.Answers[0].Header.Name, message.Answers[0].Header.TTL)
+			}
+			names = append(names, message.Answers[0].Header.Name.String())
+		}
+		if !reflect.DeepEqual(names, []string{"one.local.", "two.local."}) {
+			t.Fatalf("peer received %v, want one.local. and two.local.", names)
+		}
+		s.waitCalls(t, []string{"first", "second", "first", "second", "first", "second"})
+	})
+
+	t.Run("SendTo", func(t *testing.T) {
+		s.reset()
+		if err := s.server.SendTo(announcement("drop.local."), &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: mdns.Port}); err != nil {
+			t.Fatal(err)
+		}
+		if messages := s.receive(t); len(messages) != 0 {
+			t.Fatalf("peer received %v, want the announcement dropped", messages)
+		}
+		s.waitCalls(t, []string{"first", "second"})
+	})
+}
@@ -0,0 +1,279 @@
+package mdns
+
+import (
+	"log/slog"
+	"net"
+	"time"
+)
+
+// Option configures behaviour shared by Client and Server and may be passed to
+// both NewClient and NewServer.
+type Option func(m *mDNS)
+
+func (opt Option) applyClient(client *mClient) {
+	opt(client.mDNS)
+}
+
+func (opt Option) applyServer(server *mServer) {
+	opt(server.mDNS)
+}
+
+// ClientOption configures a Client created by NewClient.
+type ClientOption interface {
+	applyClient(client *mClient)
+}
+
+type clientOption func(client *mClient)
+
+func (opt clientOption) applyClient(client *mClient) {
+	opt(client)
+}
+
+// ServerOption configures a Server created by NewServer.
+type ServerOption interface {
+	applyServer(server *mServer)
+}
+
+type serverOption func(server *mServer)
+
+func (opt serverOption) applyServer(server *mServer) {
+	opt(server)
+}
+
+// WithStrictJoin makes Start fail if the multicast group cannot be joined on
+// every interface. By default Start only fails when no interface could join,
+// and each failed interface is reported through OnWarning as a *JoinError.
+func WithStrictJoin() Option {
+	return func(m *mDNS) {
+		m.strictJoin = true
+	}
+}
+
+// WithPort sets the UDP port used for multicast and for listening, which
+// defaults to Port. Peers only see each other when they use the same port.
+func WithPort(port int) Option {
+	return func(m *mDNS) {
+		m.port = port
+	}
+}
+
+// WithGroupIPv4 sets the IPv4 multicast group, which defaults to 224.0.0.251.
+func WithGroupIPv4(group net.IP) Option {
+	return func(m *mDNS) {
+		m.group4 = group
+	}
+}
+
+// WithGroupIPv6 sets the IPv6 multicast group, which defaults to ff02::fb.
+func WithGroupIPv6(group net.IP) Option {
+	return func(m *mDNS) {
+		m.group6 = group
+	}
+}
+
+// WithMulticastTTL sets the multicast TTL (IPv4) and hop limit (IPv6) of the
+// sockets. The default is 255, as RFC 6762 §11 requires and ValidateHopLimit
+// checks. If ttl is less than zero the system default, usually 1, is kept. A
+// value of zero keeps packets on the local host.
+func WithMulticastTTL(ttl int) Option {
+	return func(m *mDNS) {
+		m.ttl = ttl
+	}
+}
+
+// WithMulticastLoopback controls whether multicast packets sent by the sockets
+// are looped back to the local host. Loopback is on by default.
+func WithMulticastLoopback(on bool) Option {
+	return func(m *mDNS) {
+		m.loopback = on
+	}
+}
+
+// WithBindAddress sets the address that the sockets listening on the mDNS port
+// bind to, for the address family of ip. By default they bind to 224.0.0.0
+// and ff02:: respectively.
+func WithBindAddress(ip net.IP) Option {
+	return func(m *mDNS) {
+		if ip4 := ip.To4(); ip4 != nil {
+			m.bind4 = ip4
+		} else {
+			m.bind6 = ip
+		}
+	}
+}
+
+// WithReadBuffer sets the size in bytes of the receive buffer of the sockets.
+func WithReadBuffer(size int) Option {
+	return func(m *mDNS) {
+		m.readBuffer = size
+	}
+}
+
+// WithLogger sets the logger used to report internal events. By default the
+// library does not log.
+//
+// Sockets opened and recovered are logged at Info; failed joins, malformed
+// packets that are dropped, send errors and failing sockets at Warn; fatal
+// errors at Error. Joined interfaces, sent messages, dropped packets and
+// transient read errors are logged at Debug.
+func WithLogger(logger *slog.Logger) Option {
+	return func(m *mDNS) {
+		m.logger = logger
+	}
+}
+
+// WithClock sets the clock driving every timer in the library, which defaults
+// to the system clock.
+func WithClock(clock Clock) Option {
+	return func(m *mDNS) {
+		if clock != nil {
+			m.clock = clock
+		}
+	}
+}
+
+// WithTransport sets the transport used to create the sockets, which defaults
+// to the host's UDP sockets.
+func WithTransport(transport Transport) Option {
+	return func(m *mDNS) {
+		if transport != nil {
+			m.transport = transport
+		}
+	}
+}
+
+// WithDispatch sets how received packets are handed to the handlers. The
+// default is DispatchInline.
+func WithDispatch(mode DispatchMode) Option {
+	return func(m *mDNS) {
+		m.dispatchMode = mode
+	}
+}
+
+// WithWorkers sets the number of workers of DispatchPool.
+func WithWorkers(workers int) Option {
+	return func(m *mDNS) {
+		if workers > 0 {
+			m.workers = workers
+		}
+	}
+}
+
+// WithQueueDepth sets how many received packets may wait to be dispatched,
+// and how many may wait on each worker of DispatchPool.
+func WithQueueDepth(depth int) Option {
+	return func(m *mDNS) {
+		if depth > 0 {
+			m.queueDepth = depth
+		}
+	}
+}
+
+// WithDropPolicy sets what DispatchPool does when a worker queue is full. The
+// default is DropNewest.
+func WithDropPolicy(policy DropPolicy) Option {
+	return func(m *mDNS) {
+		m.dropPolicy = policy
+	}
+}
+
+// WithParseMode sets what happens to received packets with a malformed
+// section. The default is ParseLenient.
+func WithParseMode(mode ParseMode) Option {
+	return func(m *mDNS) {
+		m.parseMode = mode
+	}
+}
+
+// WithValidation sets the RFC 6762 checks applied to received messages before
+// they reach the middleware and handlers. The default is ValidateAll; pass 0
+// to handle every message.
+func WithValidation(rules ValidationRule) Option {
+	return func(m *mDNS) {
+		m.validation = rules
+	}
+}
+
+// WithSourceRateLimit limits the packets handled from each source address.
+// Packets over the limit are dropped before they are parsed.
+func WithSourceRateLimit(limit RateLimit) Option {
+	return func(m *mDNS) {
+		m.limiter.source = limit
+	}
+}
+
+// WithGlobalRateLimit limits the packets handled from all sources together.
+// Packets over the limit are dropped before they are parsed.
+func WithGlobalRateLimit(limit RateLimit) Option {
+	return func(m *mDNS) {
+		m.limiter.global = limit
+	}
+}
+
+// WithOwnPackets sets what happens to the packets sent by the Clients and
+// Servers of this process that are looped back to them. They are recognized
+// by their source, which must be a local address, and by a fingerprint of
+// the packets recently sent. A custom Transport must have an
+// InterfaceAddrs() ([]net.Addr, error) method listing the addresses of its
+// host, as memnet hosts do; otherwise no packet is recognized as own. The
+// default is OwnMark.
+func WithOwnPackets(mode OwnPacketMode) Option {
+	return func(m *mDNS) {
+		m.ownPackets = mode
+	}
+}
+
+// WithDeduplication merges the copies of a packet that arrive within window
+// over IPv4 and IPv6 or over several interfaces, so that the handlers see it
+// once, with Message.Addrs listing where it came from. Every packet is held
+// for window before it is handled, and at most 1024 packets are held at once.
+// Packets carrying A, AAAA or SRV records are matched by content, since those
+// records name their sender; other packets also by source address, so that
+// identical packets from several hosts are not merged. A window of zero, the
+// default, disables it.
+func WithDeduplication(window time.Duration) Option {
+	return func(m *mDNS) {
+		m.dedupWindow = window
+	}
+}
+
+// WithRecovery sets how a socket that fails with a read error is re-created.
+// Before every attempt it waits as long as backoff returns, and it gives up
+// after maxAttempts, reporting the error through OnError; zero means no
+// limit. Transient errors, such as timeouts, only pause the socket for
+// backoff(1). A nil backoff disables recovery, so that every read error is
+// reported through OnError. The default is an ExponentialBackoff from 100ms
+// to 30s without a limit.
+func WithRecovery(backoff Backoff, maxAttempts int) Option {
+	return func(m *mDNS) {
+		m.backoff = backoff
+		m.maxAttempts = maxAttempts
+	}
+}
+
+// WithMulticastAllInterfaces sends every multicast packet out of each
+// multicast-capable interface instead of only the default one. The copies
+// are sent in one batch where the platform supports it.
+func WithMulticastAllInterfaces() Option {
+	return func(m *mDNS) {
+		m.multicastAll = true
+	}
+}
+
+// WithInbound adds middleware around the handling of received messages, after
+// parsing and before the handlers are called. Middleware run in the order they
+// are added: the first one sees each message first.
+func WithInbound(middleware ...InboundMiddleware) Option {
+	return func(m *mDNS) {
+		m.inMiddleware = append(m.inMiddleware, middleware...)
+	}
+}
+
+// WithOutbound adds middleware around SendTo, Multicast and MulticastBatch.
+// Middleware run in the order they are added: the first one sees each message
+// first.
+func WithOutbound(middleware ...OutboundMiddleware) Option {
+	return func(m *mDNS) {
+		m.outMiddleware = append(m.outMiddleware, middleware...)
+	}
+}
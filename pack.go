@@ -0,0 +1,50 @@
+package mdns
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+	"sync"
+)
+
+// maxPooledPackBuffer bounds the buffers kept in packPool, so that one huge
+// message does not pin memory.
+const maxPooledPackBuffer = 9000
+
+var packPool = sync.Pool{
+	New: func() any {
+		var buf = make([]byte, 0, 512)
+		return &buf
+	},
+}
+
+// packAll serializes messages into pooled buffers. Call release once the
+// payloads have been sent. Errors are returned as *PackError.
+func packAll(messages []dnsmessage.Message) (payloads [][]byte, release func(), err error) {
+	var bufs = make([]*[]byte, 0, len(messages))
+	release = func() {
+		for _, buf := range bufs {
+			if cap(*buf) <= maxPooledPackBuffer {
+				*buf = (*buf)[:0]
+				packPool.Put(buf)
+			}
+		}
+	}
+
+	payloads = make([][]byte, 0, len(messages))
+	for i, message := range messages {
+		var buf = packPool.Get().(*[]byte)
+		bufs = append(bufs, buf)
+
+		var b []byte
+		if b, err = message.AppendPack((*buf)[:0]); err != nil {
+			release()
+			return nil, nil, &PackError{Index: i, Err: err}
+		}
+		*buf = b
+		if len(b) > maxMessageSize {
+			release()
+			return nil, nil, &PackError{Index: i, Err: &PacketTooLargeError{Size: len(b), Max: maxMessageSize}}
+		}
+		payloads = append(payloads, b)
+	}
+	return payloads, release, nil
+}
@@ -0,0 +1,192 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ParseMode decides what happens to a received packet with a malformed
+// section.
+type ParseMode int
+
+const (
+	// ParseLenient delivers the records parsed before the malformed one and
+	// sets Message.Malformed. Sections after the malformed one are left
+	// empty.
+	ParseLenient ParseMode = iota
+
+	// ParseStrict drops the packet and reports a *ParseError through
+	// OnWarning.
+	ParseStrict
+)
+
+// The sections of a message, as reported by ParseError.
+const (
+	SectionHeader     = "header"
+	SectionQuestion   = "question"
+	SectionAnswer     = "answer"
+	SectionAuthority  = "authority"
+	SectionAdditional = "additional"
+)
+
+// headerLen is the length of the fixed DNS message header.
+const headerLen = 12
+
+// ParseError reports where a received packet is malformed. A malformed header
+// is always reported through OnWarning, since nothing can be delivered.
+type ParseError struct {
+	// Section is one of SectionHeader, SectionQuestion, SectionAnswer,
+	// SectionAuthority and SectionAdditional.
+	Section string
+
+	// Index is the position of the malformed record within Section.
+	Index int
+
+	// Offset is the position of the malformed record in the packet, in
+	// bytes, or -1 if the records before it could not be walked.
+	Offset int
+
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Section == SectionHeader {
+		return fmt.Sprintf("malformed header: %v", e.Err)
+	}
+	return fmt.Sprintf("malformed %s %d at offset %d: %v", e.Section, e.Index, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseMessage parses data into a Message. Questions and resource records are
+// only kept if questions and resources are set, but every section is checked.
+// On error the message holds the records parsed before the malformed one.
+func parseMessage(parser *dnsmessage.Parser, data []byte, questions, resources bool) (Message, *ParseError) {
+	var nMessage Message
+	var header, err = parser.Start(data)
+	if err != nil {
+		return nMessage, &ParseError{Section: SectionHeader, Err: err}
+	}
+	nMessage.Header = header
+
+	var section = func(index int, name string, next func() error) *ParseError {
+		for i := 0; ; i++ {
+			var err = next()
+			if err == dnsmessage.ErrSectionDone {
+				return nil
+			}
+			if err != nil {
+				return &ParseError{Section: name, Index: i, Offset: recordOffset(data, index, i), Err: err}
+			}
+		}
+	}
+
+	if questions {
+		nMessage.Questions = make([]dnsmessage.Question, 0, sectionCount(data, 0))
+	}
+	if pErr := section(0, SectionQuestion, func() error {
+		if !questions {
+			return parser.SkipQuestion()
+		}
+		var question, err = parser.Question()
+		if err == nil {
+			nMessage.Questions = append(nMessage.Questions, question)
+		}
+		return err
+	}); pErr != nil {
+		return nMessage, pErr
+	}
+
+	var records = []struct {
+		name string
+		dst  *[]dnsmessage.Resource
+		next func() (dnsmessage.Resource, error)
+		skip func() error
+	}{
+		{SectionAnswer, &nMessage.Answers, parser.Answer, parser.SkipAnswer},
+		{SectionAuthority, &nMessage.Authorities, parser.Authority, parser.SkipAuthority},
+		{SectionAdditional, &nMessage.Additionals, parser.Additional, parser.SkipAdditional},
+	}
+	for i, record := range records {
+		if resources {
+			*record.dst = make([]dnsmessage.Resource, 0, sectionCount(data, i+1))
+		}
+		if pErr := section(i+1, record.name, func() error {
+			if !resources {
+				return record.skip()
+			}
+			var resource, err = record.next()
+			if err == nil {
+				*record.dst = append(*record.dst, resource)
+			}
+			return err
+		}); pErr != nil {
+			return nMessage, pErr
+		}
+	}
+	return nMessage, nil
+}
+
+// sectionCount returns the number of records the header of data announces in
+// the section with the given index, capped so that a forged count cannot
+// cause a large allocation.
+func sectionCount(data []byte, index int) int {
+	var count = int(binary.BigEndian.Uint16(data[4+2*index:]))
+	if count > 20 {
+		count = 20
+	}
+	return count
+}
+
+// recordOffset returns the offset in data of record index of the section with
+// the given index, or -1 if the records before it are malformed.
+func recordOffset(data []byte, section, index int) int {
+	var off = headerLen
+	for s := 0; s <= section; s++ {
+		var n = int(binary.BigEndian.Uint16(data[4+2*s:]))
+		if s == section {
+			n = index
+		}
+		for i := 0; i < n; i++ {
+			if off = skipName(data, off); off < 0 {
+				return -1
+			}
+			if s == 0 {
+				off += 4
+			} else {
+				if off+10 > len(data) {
+					return -1
+				}
+				off += 10 + int(binary.BigEndian.Uint16(data[off+8:]))
+			}
+			if off > len(data) {
+				return -1
+			}
+		}
+	}
+	return off
+}
+
+// skipName returns the offset following the name that starts at off, or -1.
+func skipName(data []byte, off int) int {
+	for off < len(data) {
+		var l = int(data[off])
+		switch {
+		case l == 0:
+			return off + 1
+		case l&0xC0 == 0xC0:
+			if off+2 > len(data) {
+				return -1
+			}
+			return off + 2
+		case l&0xC0 != 0:
+			return -1
+		default:
+			off += 1 + l
+		}
+	}
+	return -1
+}
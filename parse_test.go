@@ -0,0 +1,132 @@
+package mdns
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/smartwalle/mdns/internal"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// malformedQuery returns a query with two records in every section, cut in
+// the middle of the second record of the section with the given index, and
+// the offset of that record.
+func malformedQuery(t *testing.T, section int) ([]byte, int) {
+	t.Helper()
+	var name = dnsmessage.MustNewName("printer.local.")
+	var question = dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}
+	var record = func(ip byte) dnsmessage.Resource {
+		return dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 120},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, ip}},
+		}
+	}
+
+	var full, prefix dnsmessage.Message
+	full.Questions = []dnsmessage.Question{question, question}
+	full.Answers = []dnsmessage.Resource{record(1), record(2)}
+	full.Authorities = []dnsmessage.Resource{record(3), record(4)}
+	full.Additionals = []dnsmessage.Resource{record(5), record(6)}
+
+	// The records before the cut are packed the same way on their own, so
+	// the length of the prefix is the offset of the malformed record.
+	prefix.Questions = full.Questions
+	if section == 0 {
+		prefix.Questions = full.Questions[:1]
+	}
+	for i, records := range []*[]dnsmessage.Resource{&prefix.Answers, &prefix.Authorities, &prefix.Additionals} {
+		switch {
+		case i+1 < section:
+			*records = []dnsmessage.Resource{record(byte(2*i + 1)), record(byte(2*i + 2))}
+		case i+1 == section:
+			*records = []dnsmessage.Resource{record(byte(2*i + 1))}
+		}
+	}
+
+	data, err := full.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := prefix.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data[:len(b)+3], len(b)
+}
+
+func TestParseMalformed(t *testing.T) {
+	var sections = []string{SectionQuestion, SectionAnswer, SectionAuthority, SectionAdditional}
+	for index, section := range sections {
+		t.Run(section, func(t *testing.T) {
+			var data, offset = malformedQuery(t, index)
+			var src = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: Port}
+
+			for _, mode := range []ParseMode{ParseStrict, ParseLenient} {
+				var m = newMDNS()
+				WithParseMode(mode)(m)
+				var warnings []error
+				var messages []Message
+				m.OnWarning(func(addr net.Addr, err error) {
+					warnings = append(warnings, err)
+				})
+				m.OnMessage(func(addr net.Addr, message Message) {
+					messages = append(messages, message)
+				})
+				var parser dnsmessage.Parser
+				m.handle(&parser, internal.Packet{Data: data, Addr: src})
+
+				var pErr *ParseError
+				if mode == ParseStrict {
+					if len(messages) != 0 || len(warnings) != 1 || !errors.As(warnings[0], &pErr) {
+						t.Fatalf("strict: delivered %d messages and warned %v, want one *ParseError only", len(messages), warnings)
+					}
+				} else {
+					if len(warnings) != 0 || len(messages) != 1 || messages[0].Malformed == nil {
+						t.Fatalf("lenient: delivered %d messages and warned %v, want one marked Malformed", len(messages), warnings)
+					}
+					pErr = messages[0].Malformed
+
+					var counts = []int{len(messages[0].Questions), len(messages[0].Answers), len(messages[0].Authorities), len(messages[0].Additionals)}
+					for i, count := range counts {
+						var want = 0
+						switch {
+						case i < index:
+							want = 2
+						case i == index:
+							want = 1
+						}
+						if count != want {
+							t.Errorf("lenient: %s section has %d records, want %d", sections[i], count, want)
+						}
+					}
+				}
+				if pErr.Section != section || pErr.Index != 1 || pErr.Offset != offset {
+					t.Errorf("mode %d: error at %s %d offset %d, want %s 1 offset %d", mode, pErr.Section, pErr.Index, pErr.Offset, section, offset)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMalformedHeader(t *testing.T) {
+	for _, mode := range []ParseMode{ParseStrict, ParseLenient} {
+		var m = newMDNS()
+		WithParseMode(mode)(m)
+		var warnings []error
+		var delivered int
+		m.OnWarning(func(addr net.Addr, err error) {
+			warnings = append(warnings, err)
+		})
+		m.OnMessage(func(net.Addr, Message) {
+			delivered++
+		})
+		var parser dnsmessage.Parser
+		m.handle(&parser, internal.Packet{Data: make([]byte, 5), Addr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: Port}})
+
+		var pErr *ParseError
+		if delivered != 0 || len(warnings) != 1 || !errors.As(warnings[0], &pErr) || pErr.Section != SectionHeader {
+			t.Fatalf("mode %d: delivered %d messages and warned %v, want a header *ParseError only", mode, delivered, warnings)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package mdns
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	minQueryInterval = time.Second
+	maxQueryInterval = time.Hour
+)
+
+// querier implements continuous multicast DNS querying (RFC 6762 §5.2): every
+// active question is repeated at doubling intervals, re-queried as cached
+// answers approach expiry, and sent with the known answers still fresh in the
+// cache.
+type querier struct {
+	mu      sync.Mutex
+	cache   *cache
+	queries map[*query]struct{}
+	clock   Clock
+	send    func(dnsmessage.Message) error
+	warn    func(error)
+
+	// random draws the delay of first queries, or is nil to use the global
+	// source of math/rand. It is only used with mu held.
+	random *rand.Rand
+
+	// quit is closed when the client stops, and nil while it is stopped.
+	quit chan struct{}
+}
+
+type query struct {
+	question Question
+	interval time.Duration
+	due      time.Time
+	timer    Timer
+}
+
+func newQuerier(clock Clock, nCache *cache, send func(dnsmessage.Message) error, warn func(error), source rand.Source) *querier {
+	var q = &querier{
+		cache:   nCache,
+		queries: make(map[*query]struct{}),
+		clock:   clock,
+		send:    send,
+		warn:    warn,
+	}
+	if source != nil {
+		q.random = rand.New(source)
+	}
+	return q
+}
+
+// open accepts queries until close is called, and returns the channel closed
+// then. The queries of a previous run still open are stopped.
+func (q *querier) open() chan struct{} {
+	q.close()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.quit = make(chan struct{})
+	return q.quit
+}
+
+// start begins querying for question and returns the channel closed when the
+// client stops. The first query is delayed by 20-120ms so that hosts starting
+// at the same time do not query in lock step.
+func (q *querier) start(question Question) (*query, <-chan struct{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.quit == nil {
+		return nil, nil, ErrNotStarted
+	}
+
+	var delay = 20*time.Millisecond + time.Duration(q.int63n(int64(100*time.Millisecond)))
+	var nQuery = &query{
+		question: question,
+		due:      q.clock.Now().Add(delay),
+	}
+	q.queries[nQuery] = struct{}{}
+	nQuery.timer = q.clock.AfterFunc(delay, func() { q.fire(nQuery) })
+	return nQuery, q.quit, nil
+}
+
+// int63n returns a random number in [0, n). It must be called with q.mu held.
+func (q *querier) int63n(n int64) int64 {
+	if q.random == nil {
+		return rand.Int63n(n)
+	}
+	return q.random.Int63n(n)
+}
+
+func (q *querier) stop(nQuery *query) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.queries[nQuery]; ok {
+		nQuery.timer.Stop()
+		delete(q.queries, nQuery)
+	}
+}
+
+// close stops every query and refuses new ones until open is called again.
+func (q *querier) close() {
+	q.closeRun(nil)
+}
+
+// closeRun is like close, but does nothing unless quit is nil or the channel
+// returned by the last call to open, so that a client started again is not
+// stopped by the end of its previous run.
+func (q *querier) closeRun(quit chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.quit == nil || (quit != nil && quit != q.quit) {
+		return
+	}
+	for nQuery := range q.queries {
+		nQuery.timer.Stop()
+		delete(q.queries, nQuery)
+	}
+	close(q.quit)
+	q.quit = nil
+}
+
+// observe caches the records carried by a response from src and reschedules
+// the active queries so that the new records are refreshed in time. It
+// returns the number of records not cached because src is over its quota.
+func (q *querier) observe(src net.Addr, resource Resource) (rejected int) {
+	if !resource.Header.Response {
+		return 0
+	}
+
+	var source = sourceKey(src)
+	var now = q.clock.Now()
+	for _, record := range resource.Answers {
+		if !q.cache.add(source, record, now) {
+			rejected++
+		}
+	}
+	for _, record := range resource.Additionals {
+		if !q.cache.add(source, record, now) {
+			rejected++
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for nQuery := range q.queries {
+		q.schedule(nQuery, now)
+	}
+	return rejected
+}
+
+func (q *querier) fire(nQuery *query) {
+	q.mu.Lock()
+	if _, ok := q.queries[nQuery]; !ok {
+		q.mu.Unlock()
+		return
+	}
+
+	var now = q.clock.Now()
+	if !now.Before(nQuery.due) {
+		if nQuery.interval == 0 {
+			nQuery.interval = minQueryInterval
+		} else if nQuery.interval *= 2; nQuery.interval > maxQueryInterval {
+			nQuery.interval = maxQueryInterval
+		}
+		nQuery.due = now.Add(nQuery.interval)
+	}
+	var message = q.message(nQuery.question, now)
+	q.schedule(nQuery, now)
+	q.mu.Unlock()
+
+	if err := q.send(message); err != nil && q.warn != nil {
+		q.warn(err)
+	}
+}
+
+// schedule arms the timer of nQuery for the earlier of its next backoff
+// deadline and the next refresh point of a cached answer.
+func (q *querier) schedule(nQuery *query, now time.Time) {
+	var next = nQuery.due
+	for _, question := range nQuery.question.Questions {
+		for _, entry := range q.cache.answers(question, now) {
+			if at, ok := entry.refreshAfter(now); ok && at.Before(next) {
+				next = at
+			}
+		}
+	}
+	nQuery.timer.Reset(next.Sub(now))
+}
+
+// message builds the query for question, listing as known answers the cached
+// records with more than half of their lifetime left (RFC 6762 §7.1).
+func (q *querier) message(question Question, now time.Time) dnsmessage.Message {
+	var message = dnsmessage.Message{
+		Header:    question.Header,
+		Questions: question.Questions,
+	}
+	for _, nQuestion := range question.Questions {
+		for _, entry := range q.cache.answers(nQuestion, now) {
+			if entry.remaining(now) > 0.5 {
+				var answer = entry.resource
+				answer.Header.TTL = uint32(entry.expires.Sub(now) / time.Second)
+				message.Answers = append(message.Answers, answer)
+			}
+		}
+	}
+	return message
+}
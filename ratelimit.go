@@ -0,0 +1,127 @@
+package mdns
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxRateSources bounds the number of sources whose rate is tracked. Beyond
+// it the source seen least recently is forgotten, so that a flooding source
+// keeps its bucket.
+const maxRateSources = 4096
+
+// RateLimit allows Rate packets per second on average, in bursts of up to
+// Burst packets. A zero Rate disables the limit; a Burst below one is taken
+// as Rate, rounded up.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst >= 1 {
+		return float64(l.Burst)
+	}
+	if l.Rate < 1 {
+		return 1
+	}
+	return float64(int(l.Rate + 0.999))
+}
+
+// bucket is a token bucket for one RateLimit.
+type bucket struct {
+	tokens float64
+	last   time.Time
+
+	// key and elem place the bucket of a source in limiter.lru.
+	key  string
+	elem *list.Element
+}
+
+func (b *bucket) allow(limit RateLimit, now time.Time) bool {
+	b.refill(limit, now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *bucket) refill(limit RateLimit, now time.Time) {
+	var burst = limit.burst()
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * limit.Rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+}
+
+// limiter applies the per-source and global rate limits to received packets.
+type limiter struct {
+	mu      sync.Mutex
+	source  RateLimit
+	global  RateLimit
+	all     bucket
+	sources map[string]*bucket
+	lru     *list.List
+}
+
+// allow reports whether a packet from src received at now is within the
+// limits, or the reason it is not.
+func (l *limiter) allow(src net.Addr, now time.Time) (DropReason, bool) {
+	if l.source.Rate <= 0 && l.global.Rate <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.source.Rate > 0 && src != nil {
+		if !l.sourceBucket(src).allow(l.source, now) {
+			return ReasonSourceRateLimit, false
+		}
+	}
+	if l.global.Rate > 0 && !l.all.allow(l.global, now) {
+		return ReasonGlobalRateLimit, false
+	}
+	return 0, true
+}
+
+func (l *limiter) sourceBucket(src net.Addr) *bucket {
+	var key = sourceKey(src)
+	if b, ok := l.sources[key]; ok {
+		l.lru.MoveToFront(b.elem)
+		return b
+	}
+
+	if l.sources == nil {
+		l.sources = make(map[string]*bucket)
+		l.lru = list.New()
+	}
+	if len(l.sources) >= maxRateSources {
+		var oldest = l.lru.Remove(l.lru.Back()).(*bucket)
+		delete(l.sources, oldest.key)
+	}
+
+	var b = &bucket{key: key}
+	b.elem = l.lru.PushFront(b)
+	l.sources[key] = b
+	return b
+}
+
+// sourceKey identifies the host that sent from addr, ignoring the port.
+func sourceKey(addr net.Addr) string {
+	if addr, ok := addr.(*net.UDPAddr); ok {
+		return addr.IP.String()
+	}
+	if addr != nil {
+		return addr.String()
+	}
+	return ""
+}
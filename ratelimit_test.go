@@ -0,0 +1,27 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimiterKeepsFloodingSource(t *testing.T) {
+	var l = limiter{source: RateLimit{Rate: 1, Burst: 1}}
+	var now = time.Unix(0, 0)
+	var flooder = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: Port}
+
+	if _, ok := l.allow(flooder, now); !ok {
+		t.Fatal("first packet dropped")
+	}
+	for i := 0; i < 2*maxRateSources; i++ {
+		var src = &net.UDPAddr{IP: net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)), Port: Port}
+		l.allow(src, now)
+		if _, ok := l.allow(flooder, now); ok {
+			t.Fatalf("flooding source allowed after %d other sources", i+1)
+		}
+	}
+	if len(l.sources) > maxRateSources {
+		t.Fatalf("%d sources tracked, want at most %d", len(l.sources), maxRateSources)
+	}
+}
@@ -0,0 +1,91 @@
+package mdns
+
+import (
+	"github.com/smartwalle/mdns/internal"
+	"time"
+)
+
+// RecoveryEvent reports the recovery of a socket after a read error.
+type RecoveryEvent = internal.RecoveryEvent
+
+// RecoveryState tells what happened to a socket in a RecoveryEvent.
+type RecoveryState = internal.RecoveryState
+
+const (
+	// RecoveryTransient is reported for a read error after which the socket
+	// keeps being read, such as a timeout or ENOBUFS.
+	RecoveryTransient = internal.RecoveryTransient
+
+	// RecoveryStarted is reported when a socket failed and is about to be
+	// re-created.
+	RecoveryStarted = internal.RecoveryStarted
+
+	// RecoveryFailed is reported for every failed attempt to re-create a
+	// socket.
+	RecoveryFailed = internal.RecoveryFailed
+
+	// RecoveryDone is reported once a socket has been re-created and has
+	// rejoined its multicast group.
+	RecoveryDone = internal.RecoveryDone
+)
+
+// The default backoff between the attempts to re-create a failed socket.
+const (
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// Backoff returns how long to wait before the given attempt to re-create a
+// failed socket, counting from 1.
+type Backoff func(attempt int) time.Duration
+
+// ExponentialBackoff waits min before the first attempt and doubles the wait
+// after every failed attempt, up to max.
+func ExponentialBackoff(min, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		var d = min
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// OnRecovery calls handler for every RecoveryEvent. The handler runs on the
+// receive path and must return quickly.
+func (m *mDNS) OnRecovery(handler func(RecoveryEvent)) {
+	m.hmu.Lock()
+	defer m.hmu.Unlock()
+	m.rcHandler = handler
+}
+
+func (m *mDNS) recovery(event RecoveryEvent) {
+	m.logRecovery(event)
+	m.reportJoinErrors()
+	m.hmu.RLock()
+	var handler = m.rcHandler
+	m.hmu.RUnlock()
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// supervisor returns how the sockets of m recover from read errors, or nil
+// if recovery is disabled.
+func (m *mDNS) supervisor() *internal.Supervisor {
+	if m.backoff == nil {
+		return nil
+	}
+	return &internal.Supervisor{
+		Backoff:     m.backoff,
+		MaxAttempts: m.maxAttempts,
+		After: func(d time.Duration) <-chan time.Time {
+			return m.clock.NewTimer(d).C()
+		},
+		Interfaces: m.transport.Interfaces,
+		OnEvent:    m.recovery,
+	}
+}
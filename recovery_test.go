@@ -0,0 +1,231 @@
+package mdns_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartwalle/mdns"
+	"github.com/smartwalle/mdns/mdnstest"
+	"github.com/smartwalle/mdns/memnet"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// flakyTransport lets a test fail the next read of its last socket, or the
+// creation of the next sockets.
+type flakyTransport struct {
+	*memnet.Host
+	mu    sync.Mutex
+	conn  *flakyConn
+	fails int
+}
+
+func (t *flakyTransport) ListenPacket(network string, addr *net.UDPAddr) (mdns.PacketConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fails > 0 {
+		t.fails--
+		return nil, errors.New("no socket")
+	}
+	conn, err := t.Host.ListenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	t.conn = &flakyConn{PacketConn: conn}
+	return t.conn, nil
+}
+
+// failNext makes the read following the next packet of the last socket fail
+// with err, and the next fails sockets fail to be created.
+func (t *flakyTransport) failNext(err error, fails int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fails = fails
+	t.conn.mu.Lock()
+	t.conn.err = err
+	t.conn.mu.Unlock()
+}
+
+type flakyConn struct {
+	mdns.PacketConn
+	mu  sync.Mutex
+	err error
+}
+
+func (c *flakyConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	var err = c.err
+	c.err = nil
+	c.mu.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+	return c.PacketConn.ReadFrom(b)
+}
+
+type recoveryTest struct {
+	t         *testing.T
+	clock     *mdnstest.FakeClock
+	transport *flakyTransport
+	client    mdns.Client
+	questions chan struct{}
+	events    chan mdns.RecoveryEvent
+}
+
+func newRecoveryTest(t *testing.T) *recoveryTest {
+	var network = memnet.NewNetwork()
+	var link = network.NewLink("lan")
+	var server = network.NewHost("server")
+	server.AddInterface("eth0", link, net.IPv4(192, 0, 2, 1))
+	var client = network.NewHost("client")
+	client.AddInterface("eth0", link, net.IPv4(192, 0, 2, 2))
+
+	var rt = &recoveryTest{
+		t:         t,
+		clock:     mdnstest.NewFakeClock(time.Unix(0, 0)),
+		transport: &flakyTransport{Host: server},
+		questions: make(chan struct{}, 8),
+		events:    make(chan mdns.RecoveryEvent, 8),
+	}
+
+	var nServer = mdns.NewServer(
+		mdns.WithTransport(rt.transport),
+		mdns.WithClock(rt.clock),
+		mdns.WithRecovery(mdns.ExponentialBackoff(time.Second, time.Minute), 0),
+	)
+	nServer.EnableIPv4()
+	nServer.OnQuestion(func(net.Addr, mdns.Question) {
+		rt.questions <- struct{}{}
+	})
+	nServer.OnRecovery(func(event mdns.RecoveryEvent) {
+		rt.events <- event
+	})
+	nServer.OnError(func(err error) {
+		t.Errorf("OnError: %v", err)
+	})
+	if err := nServer.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = nServer.Stop(context.Background())
+	})
+
+	rt.client = mdns.NewClient(mdns.WithTransport(client))
+	rt.client.EnableIPv4()
+	if err := rt.client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = rt.client.Stop(context.Background())
+	})
+	return rt
+}
+
+// query sends a query to the server and waits until it is received.
+func (rt *recoveryTest) query() {
+	rt.t.Helper()
+	rt.send()
+	rt.received()
+}
+
+func (rt *recoveryTest) send() {
+	rt.t.Helper()
+	var question = mdns.Question{
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("printer.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	if err := rt.client.Send(question); err != nil {
+		rt.t.Fatal(err)
+	}
+}
+
+func (rt *recoveryTest) received() {
+	rt.t.Helper()
+	select {
+	case <-rt.questions:
+	case <-time.After(5 * time.Second):
+		rt.t.Fatal("query not received")
+	}
+}
+
+func (rt *recoveryTest) event(state mdns.RecoveryState, attempt int) {
+	rt.t.Helper()
+	select {
+	case event := <-rt.events:
+		if event.State != state || event.Attempt != attempt {
+			rt.t.Fatalf("got event %v attempt %d (%v), want %v attempt %d", event.State, event.Attempt, event.Err, state, attempt)
+		}
+	case <-time.After(5 * time.Second):
+		rt.t.Fatalf("no %v event", state)
+	}
+}
+
+// advance waits until the supervisor has armed its timer and moves the clock
+// to its deadline.
+func (rt *recoveryTest) advance(want time.Duration) {
+	rt.t.Helper()
+	var start = rt.clock.Now()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if next, ok := rt.clock.Next(); ok {
+			if got := next.Sub(start); got != want {
+				rt.t.Fatalf("backoff %v, want %v", got, want)
+			}
+			rt.clock.Set(next)
+			return
+		}
+		if time.Now().After(deadline) {
+			rt.t.Fatal("no backoff timer")
+		}
+	}
+}
+
+func TestRecoveryTransient(t *testing.T) {
+	var rt = newRecoveryTest(t)
+	rt.query()
+
+	rt.transport.failNext(os.ErrDeadlineExceeded, 0)
+	rt.query()
+	rt.event(mdns.RecoveryTransient, 0)
+
+	// The socket is not read again until the pause is over.
+	rt.send()
+	select {
+	case <-rt.questions:
+		t.Fatal("query received during the pause")
+	case <-time.After(50 * time.Millisecond):
+	}
+	rt.advance(time.Second)
+	rt.received()
+
+	select {
+	case event := <-rt.events:
+		t.Fatalf("unexpected event %v", event.State)
+	default:
+	}
+}
+
+func TestRecoveryRecreatesSocket(t *testing.T) {
+	var rt = newRecoveryTest(t)
+	rt.query()
+
+	var old = rt.transport.conn
+	rt.transport.failNext(errors.New("socket broken"), 1)
+	rt.query()
+	rt.event(mdns.RecoveryStarted, 0)
+
+	rt.advance(time.Second)
+	rt.event(mdns.RecoveryFailed, 1)
+	rt.advance(2 * time.Second)
+	rt.event(mdns.RecoveryDone, 2)
+
+	if rt.transport.conn == old {
+		t.Fatal("socket was not re-created")
+	}
+	if _, _, err := old.PacketConn.ReadFrom(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("old socket not closed: %v", err)
+	}
+	rt.query()
+}
@@ -0,0 +1,131 @@
+package mdns
+
+import (
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+)
+
+// OwnPacketMode decides what happens to packets sent by this process that are
+// looped back to it.
+type OwnPacketMode int
+
+const (
+	// OwnMark delivers own packets with Message.Own set.
+	OwnMark OwnPacketMode = iota
+
+	// OwnFilter drops own packets before they reach the middleware and
+	// handlers.
+	OwnFilter
+)
+
+// sentLogSize is the number of packets remembered by sentLog. Looped back
+// packets arrive within milliseconds, so only the latest sends matter.
+const sentLogSize = 256
+
+// localAddrsTTL is how long the addresses of the local host are cached.
+const localAddrsTTL = 30 * time.Second
+
+// sent remembers the fingerprints of the packets recently sent by every Client
+// and Server of the process, so that a Server also recognizes the queries of
+// a Client running next to it.
+var sent sentLog
+
+// sentLog is a ring of packet fingerprints.
+type sentLog struct {
+	mu     sync.Mutex
+	ring   [sentLogSize]uint64
+	next   int
+	counts map[uint64]int
+}
+
+func fingerprint(payload []byte) uint64 {
+	var h = fnv.New64a()
+	_, _ = h.Write(payload)
+	return h.Sum64()
+}
+
+func (l *sentLog) add(payload []byte) {
+	var sum = fingerprint(payload)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.counts == nil {
+		l.counts = make(map[uint64]int)
+	}
+	if old := l.ring[l.next]; old != 0 {
+		if l.counts[old]--; l.counts[old] <= 0 {
+			delete(l.counts, old)
+		}
+	}
+	l.ring[l.next] = sum
+	l.counts[sum]++
+	l.next = (l.next + 1) % sentLogSize
+}
+
+func (l *sentLog) contains(payload []byte) bool {
+	var sum = fingerprint(payload)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.counts[sum] > 0
+}
+
+// addressLister is implemented by transports that can list the addresses of
+// the local host, such as UDPTransport.
+type addressLister interface {
+	InterfaceAddrs() ([]net.Addr, error)
+}
+
+// localAddrs caches the addresses of the local host.
+type localAddrs struct {
+	mu      sync.Mutex
+	ips     []net.IP
+	fetched time.Time
+}
+
+// contains reports whether ip belongs to the local host according to
+// transport. It returns false if transport cannot list the addresses, as
+// packets from other hosts may match a recent send byte for byte.
+func (a *localAddrs) contains(transport Transport, ip net.IP, now time.Time) bool {
+	var lister, ok = transport.(addressLister)
+	if !ok {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.fetched.IsZero() || now.Sub(a.fetched) >= localAddrsTTL {
+		a.ips = a.ips[:0]
+		var addrs, _ = lister.InterfaceAddrs()
+		for _, addr := range addrs {
+			switch addr := addr.(type) {
+			case *net.IPNet:
+				a.ips = append(a.ips, addr.IP)
+			case *net.IPAddr:
+				a.ips = append(a.ips, addr.IP)
+			}
+		}
+		a.fetched = now
+	}
+
+	for _, local := range a.ips {
+		if local.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// own reports whether data, received from src, was sent by this process: it
+// must come from an address of the local host and match a recent send.
+func (m *mDNS) own(src net.Addr, data []byte, now time.Time) bool {
+	if !sent.contains(data) {
+		return false
+	}
+	var addr, ok = src.(*net.UDPAddr)
+	return ok && m.locals.contains(m.transport, addr.IP, now)
+}
@@ -0,0 +1,86 @@
+package mdns
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSentLogExpiry(t *testing.T) {
+	var l sentLog
+	var payload = []byte("own packet")
+	l.add(payload)
+
+	for i := 0; i < sentLogSize-1; i++ {
+		l.add([]byte(fmt.Sprintf("packet %d", i)))
+	}
+	if !l.contains(payload) {
+		t.Fatalf("packet forgotten after %d later sends", sentLogSize-1)
+	}
+	l.add([]byte("one more"))
+	if l.contains(payload) {
+		t.Fatalf("packet remembered after %d later sends", sentLogSize)
+	}
+}
+
+// addrTransport is a Transport that only lists the addresses of its host.
+type addrTransport struct {
+	addrs []net.Addr
+}
+
+func (t *addrTransport) Interfaces() ([]net.Interface, error) {
+	return nil, nil
+}
+
+func (t *addrTransport) ListenPacket(network string, addr *net.UDPAddr) (PacketConn, error) {
+	return nil, net.UnknownNetworkError(network)
+}
+
+func (t *addrTransport) InterfaceAddrs() ([]net.Addr, error) {
+	return t.addrs, nil
+}
+
+func TestOwn(t *testing.T) {
+	var transport = &addrTransport{addrs: []net.Addr{&net.IPNet{IP: net.IPv4(192, 0, 2, 1), Mask: net.CIDRMask(24, 32)}}}
+	var m = newMDNS()
+	WithTransport(transport)(m)
+
+	// sent is shared by every test of the process, so the packet is unique.
+	var payload = []byte(fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano()))
+	var local = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: Port}
+	var peer = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: Port}
+	var now = time.Unix(0, 0)
+	if m.own(local, payload, now) {
+		t.Fatal("a packet never sent is own")
+	}
+
+	sent.add(payload)
+	if !m.own(local, payload, now) {
+		t.Fatal("a sent packet from a local address is not own")
+	}
+	if m.own(peer, payload, now) {
+		t.Fatal("a sent packet from another host is own")
+	}
+
+	// The addresses of the host are cached for localAddrsTTL.
+	transport.addrs = []net.Addr{&net.IPAddr{IP: peer.IP}}
+	if !m.own(local, payload, now.Add(localAddrsTTL-time.Second)) {
+		t.Fatal("the local addresses were listed again before they expired")
+	}
+	if m.own(local, payload, now.Add(localAddrsTTL)) || !m.own(peer, payload, now.Add(localAddrsTTL)) {
+		t.Fatal("the local addresses were not listed again once expired")
+	}
+
+	// Without a way to list the local addresses nothing is own.
+	var unknown = newMDNS()
+	WithTransport(transportOnly{transport})(unknown)
+	if unknown.own(local, payload, now) {
+		t.Fatal("a packet is own although the local addresses are unknown")
+	}
+}
+
+// transportOnly hides the InterfaceAddrs method of a Transport.
+type transportOnly struct {
+	Transport
+}
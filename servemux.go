@@ -0,0 +1,131 @@
+package mdns
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+	"strings"
+	"sync"
+)
+
+// ServeMux routes questions to the handler registered for their name and
+// type.
+//
+// A pattern is either a name, such as "printer.local.", or a wildcard such as
+// "*._ipp._tcp.local." that matches every name ending in "._ipp._tcp.local.".
+// Names are compared case-insensitively, with or without the trailing dot.
+// When several patterns match, a name wins over a wildcard and a longer
+// wildcard over a shorter one.
+//
+// A handler registered with dnsmessage.TypeALL serves every type, but a
+// handler registered for the type of the question is preferred. Questions of
+// type ANY are served by every handler of the winning pattern.
+type ServeMux struct {
+	mu      sync.RWMutex
+	entries []muxEntry
+}
+
+type muxEntry struct {
+	name     string
+	wildcard bool
+	typ      dnsmessage.Type
+	handler  Handler
+}
+
+// NewServeMux creates an empty ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{}
+}
+
+// Handle registers handler for the questions matching pattern and typ,
+// replacing any handler registered for the same pattern and type.
+func (mux *ServeMux) Handle(pattern string, typ dnsmessage.Type, handler Handler) {
+	if handler == nil {
+		panic("mdns: nil handler")
+	}
+
+	var nEntry = muxEntry{typ: typ, handler: handler}
+	nEntry.name = canonicalName(pattern)
+	if strings.HasPrefix(nEntry.name, "*.") {
+		nEntry.wildcard = true
+		nEntry.name = nEntry.name[1:]
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	for i, entry := range mux.entries {
+		if entry.name == nEntry.name && entry.wildcard == nEntry.wildcard && entry.typ == nEntry.typ {
+			mux.entries[i] = nEntry
+			return
+		}
+	}
+	mux.entries = append(mux.entries, nEntry)
+}
+
+// HandleFunc registers handler for the questions matching pattern and typ.
+func (mux *ServeMux) HandleFunc(pattern string, typ dnsmessage.Type, handler func(ResponseWriter, *Request)) {
+	mux.Handle(pattern, typ, HandlerFunc(handler))
+}
+
+// ServeMDNS calls the handlers matching r.Question. Questions that match no
+// pattern are not answered.
+func (mux *ServeMux) ServeMDNS(w ResponseWriter, r *Request) {
+	for _, handler := range mux.Handlers(r.Question) {
+		handler.ServeMDNS(w, r)
+	}
+}
+
+// Handlers returns the handlers that ServeMDNS calls for question.
+func (mux *ServeMux) Handlers(question dnsmessage.Question) []Handler {
+	var name = canonicalName(question.Name.String())
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	var best = -1
+	var handlers []Handler
+	for _, entry := range mux.entries {
+		var score = entry.score(name, question.Type)
+		if score < 0 || score < best {
+			continue
+		}
+		if score > best {
+			best = score
+			handlers = handlers[:0]
+		}
+		handlers = append(handlers, entry.handler)
+	}
+	return handlers
+}
+
+// score ranks how well e matches a question for name and typ, or returns -1
+// if it does not match.
+func (e *muxEntry) score(name string, typ dnsmessage.Type) int {
+	var score int
+	switch {
+	case !e.wildcard && name == e.name:
+		score = 1<<16 + len(e.name)
+	case e.wildcard && len(name) > len(e.name) && strings.HasSuffix(name, e.name):
+		score = len(e.name)
+	default:
+		return -1
+	}
+
+	switch {
+	case typ == dnsmessage.TypeALL:
+		return score * 2
+	case e.typ == typ:
+		return score*2 + 1
+	case e.typ == dnsmessage.TypeALL:
+		return score * 2
+	default:
+		return -1
+	}
+}
+
+func canonicalName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
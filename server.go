@@ -26,13 +26,19 @@ type Server interface {
 	// Must be no greater than 255.
 	SetMulticastTTL(ttl int) error
 
-	// OnQuestion calls handler on every Question received.
+	// OnQuestion calls handler on every Question received. Handlers may be
+	// registered or replaced at any time, including while m is running.
 	OnQuestion(handler func(net.Addr, Question))
 
 	// OnResource calls handler on every Resource received.
 	OnResource(handler func(net.Addr, Resource))
 
-	// OnWarning calls handler on every non-fatal error.
+	// OnMessage calls handler on every message received, with all of its
+	// sections. It is called before the OnQuestion and OnResource handlers.
+	OnMessage(handler func(net.Addr, Message))
+
+	// OnWarning calls handler on every non-fatal error, including a *JoinError
+	// for every interface that could not join the multicast group on Start.
 	OnWarning(handler func(net.Addr, error))
 
 	// OnError calls handler on every fatal error. After
@@ -40,8 +46,18 @@ type Server interface {
 	// close it's connection so this function will not be called twice.
 	OnError(handler func(error))
 
+	// OnDrop calls handler every time a received packet is dropped, with its
+	// source and the reason. The handler runs on the receive path and must
+	// return quickly.
+	OnDrop(handler func(net.Addr, DropReason))
+
+	// OnRecovery calls handler as a socket that failed with a read error is
+	// re-created, see WithRecovery. The handler must return quickly.
+	OnRecovery(handler func(RecoveryEvent))
+
 	// Start causes m to start listening for mDNS packets on all interfaces on
-	// the specified port. Listening will stop if ctx is done.
+	// the specified port. Listening will stop if ctx is done. Once stopped, m
+	// may be started again.
 	Start(ctx context.Context) error
 
 	// SendTo serializes and sends packet to dst. If dst is a multicast
@@ -55,63 +71,95 @@ type Server interface {
 	// called prior to making this call.
 	Multicast(resource Resource) error
 
-	// Stop closes all connections.
+	// MulticastBatch is like Multicast for several resources, such as one
+	// announcement round. The packets are sent with one system call per
+	// address family where the platform supports it.
+	MulticastBatch(resources ...Resource) error
+
+	// Stop closes all connections and waits until every goroutine started by
+	// Start has exited, or ctx is done. Do not call Stop from a handler with a
+	// context that never ends, as handlers run on one of those goroutines.
 	Stop(ctx context.Context) error
+
+	// Done returns a channel that is closed once every goroutine started by
+	// the last call to Start has exited.
+	Done() <-chan struct{}
+
+	// Wait blocks until every goroutine started by the last call to Start has
+	// exited.
+	Wait()
+
+	// Stats returns a snapshot of the packet counters.
+	Stats() Stats
 }
 
 type mServer struct {
 	*mDNS
 }
 
-// NewServer creates a new object implementing the Server interface. Do not forget
-// to call EnableIPv4() or EnableIPv6() to enable listening on interfaces of
-// the corresponding type, or nothing will work.
-func NewServer() Server {
+// NewServer creates a new object implementing the Server interface, configured
+// by opts. Do not forget to call EnableIPv4() or EnableIPv6() to enable
+// listening on interfaces of the corresponding type, or nothing will work.
+func NewServer(opts ...ServerOption) Server {
 	var nServer = &mServer{}
-	nServer.mDNS = &mDNS{}
+	nServer.mDNS = newMDNS()
 	nServer.mDNS.conn4 = nil
 	nServer.mDNS.conn6 = nil
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt.applyServer(nServer)
+		}
+	}
+	nServer.buildChains()
+
 	return nServer
 }
 
 func (m *mServer) EnableIPv4() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.conn4 == nil {
 		var mAddr = &net.UDPAddr{
-			IP:   mDNSMulticastIPv4,
-			Port: Port,
+			IP:   m.group4,
+			Port: m.port,
 		}
 		var lAddr = &net.UDPAddr{
-			IP:   mDNSWildcardIPv4,
-			Port: Port,
+			IP:   m.bind4,
+			Port: m.port,
 		}
 		m.conn4 = internal.NewConn(
 			mAddr,
 			lAddr,
 			nil,
-			&internal.IPv4PacketConnFactory{Group: &net.UDPAddr{IP: mDNSMulticastIPv4}},
+			m.factory4(true),
 			nil,
-			-1,
+			m.ttl,
 		)
 	}
 }
 
 func (m *mServer) EnableIPv6() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.conn6 == nil {
 		var mAddr = &net.UDPAddr{
-			IP:   mDNSMulticastIPv6,
-			Port: Port,
+			IP:   m.group6,
+			Port: m.port,
 		}
 		var lAddr = &net.UDPAddr{
-			IP:   mDNSWildcardIPv6,
-			Port: Port,
+			IP:   m.bind6,
+			Port: m.port,
 		}
 		m.conn6 = internal.NewConn(
 			mAddr,
 			lAddr,
 			nil,
-			&internal.IPv6PacketConnFactory{Group: &net.UDPAddr{IP: mDNSMulticastIPv6}},
+			m.factory6(true),
 			nil,
-			-1,
+			m.ttl,
 		)
 	}
 }
@@ -126,6 +174,10 @@ func (m *mServer) SendTo(resource Resource, dst *net.UDPAddr) error {
 	return m.mDNS.SendTo(message, dst)
 }
 
+func (m *mServer) sendMessage(message dnsmessage.Message, dst *net.UDPAddr) error {
+	return m.mDNS.SendTo(message, dst)
+}
+
 func (m *mServer) Multicast(resource Resource) error {
 	var message = dnsmessage.Message{
 		Header:      resource.Header,
@@ -135,3 +187,16 @@ func (m *mServer) Multicast(resource Resource) error {
 	}
 	return m.mDNS.Multicast(message)
 }
+
+func (m *mServer) MulticastBatch(resources ...Resource) error {
+	var messages = make([]dnsmessage.Message, 0, len(resources))
+	for _, resource := range resources {
+		messages = append(messages, dnsmessage.Message{
+			Header:      resource.Header,
+			Answers:     resource.Answers,
+			Authorities: resource.Authorities,
+			Additionals: resource.Additionals,
+		})
+	}
+	return m.mDNS.MulticastBatch(messages)
+}
@@ -0,0 +1,171 @@
+package mdns_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smartwalle/mdns"
+	"github.com/smartwalle/mdns/memnet"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// freePort returns a UDP port that is unused at the time of the call.
+func freePort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestServersSharePort(t *testing.T) {
+	// Sockets bound to the group address are shared by the Go runtime
+	// anyway; the unspecified address, which system responders use, is only
+	// shared with address reuse.
+	for _, bind := range []net.IP{net.IPv4(224, 0, 0, 0), net.IPv4zero} {
+		t.Run(bind.String(), func(t *testing.T) {
+			testServersSharePort(t, bind)
+		})
+	}
+}
+
+func testServersSharePort(t *testing.T, bind net.IP) {
+	var port = freePort(t)
+	var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var received = make([]chan struct{}, 2)
+	for i := range received {
+		var ch = make(chan struct{}, 1)
+		received[i] = ch
+
+		var server = mdns.NewServer(mdns.WithPort(port), mdns.WithBindAddress(bind))
+		server.EnableIPv4()
+		server.OnQuestion(func(addr net.Addr, question mdns.Question) {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		})
+		var err = server.Start(ctx)
+		if err != nil && i == 0 {
+			t.Skipf("multicast is not available: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("second server on port %d: %v", port, err)
+		}
+		defer server.Stop(context.Background())
+	}
+
+	var client = mdns.NewClient(mdns.WithPort(port))
+	client.EnableIPv4()
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop(context.Background())
+
+	var name = dnsmessage.MustNewName("shared.local.")
+	var question = mdns.Question{
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+
+	for i, ch := range received {
+		for {
+			if err := client.Send(question); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-ch:
+			case <-time.After(100 * time.Millisecond):
+				continue
+			case <-ctx.Done():
+				t.Fatalf("server %d did not receive the query", i)
+			}
+			break
+		}
+	}
+}
+
+func TestServerOwnPackets(t *testing.T) {
+	for _, mode := range []mdns.OwnPacketMode{mdns.OwnMark, mdns.OwnFilter} {
+		var network = memnet.NewNetwork()
+		var lan = network.NewLink("lan")
+		var serverHost = network.NewHost("server")
+		serverHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 1))
+		var peerHost = network.NewHost("peer")
+		peerHost.AddInterface("eth0", lan, net.IPv4(192, 0, 2, 2))
+
+		var server = mdns.NewServer(mdns.WithTransport(serverHost), mdns.WithOwnPackets(mode))
+		server.EnableIPv4()
+		var received = make(chan mdns.Message, 2)
+		server.OnMessage(func(addr net.Addr, message mdns.Message) {
+			received <- message
+		})
+		var dropped = make(chan mdns.DropReason, 1)
+		server.OnDrop(func(addr net.Addr, reason mdns.DropReason) {
+			dropped <- reason
+		})
+		if err := server.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer server.Stop(context.Background())
+
+		// The server receives its own announcement through multicast
+		// loopback.
+		var resource = mdns.Resource{
+			Header: dnsmessage.Header{Response: true, Authoritative: true},
+			Answers: []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("own.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 120},
+				Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+			}},
+		}
+		if err := server.Multicast(resource); err != nil {
+			t.Fatal(err)
+		}
+		if mode == mdns.OwnMark {
+			select {
+			case message := <-received:
+				if !message.Own || len(message.Answers) != 1 {
+					t.Fatalf("own announcement delivered with Own %v and %d answers, want Own set", message.Own, len(message.Answers))
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("own announcement not delivered")
+			}
+		} else {
+			select {
+			case reason := <-dropped:
+				if reason != mdns.ReasonOwn || server.Stats().Own != 1 {
+					t.Fatalf("own announcement dropped with %v and Own counter %d, want ReasonOwn and 1", reason, server.Stats().Own)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("own announcement not dropped")
+			}
+		}
+
+		// The same packet sent by another host is not own.
+		var conn, err = peerHost.ListenPacket("udp4", &net.UDPAddr{Port: mdns.Port})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		data, err := (&dnsmessage.Message{Header: resource.Header, Answers: resource.Answers}).Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = conn.WriteTo(data, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: mdns.Port}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case message := <-received:
+			if message.Own {
+				t.Fatal("a packet from another host is marked Own")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the packet from another host was not delivered")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package mdns
+
+import "sync/atomic"
+
+// Stats holds counters of the packets seen by a Client or Server since it
+// was created.
+type Stats struct {
+	// Received is the number of packets read from the sockets.
+	Received uint64
+
+	// Dropped is the number of packets dropped because a dispatch queue was
+	// full.
+	Dropped uint64
+
+	// InvalidOpcode, InvalidRcode and InvalidSourcePort are the numbers of
+	// packets dropped by the ValidateOpcode, ValidateRcode and
+	// ValidateSourcePort rules.
+	InvalidOpcode     uint64
+	InvalidRcode      uint64
+	InvalidSourcePort uint64
+
+	// IgnoredQuestions is the number of responses whose questions were
+	// cleared by the ValidateResponseQuestions rule.
+	IgnoredQuestions uint64
+
+	// InvalidHopLimit and OffLink are the numbers of packets dropped by the
+	// ValidateHopLimit and ValidateSourceAddress rules.
+	InvalidHopLimit uint64
+	OffLink         uint64
+
+	// RateLimited is the number of packets dropped by the limits set with
+	// WithSourceRateLimit and WithGlobalRateLimit.
+	RateLimited uint64
+
+	// CacheRejected is the number of records not cached because their source
+	// was over the quota set with WithCacheSourceQuota.
+	CacheRejected uint64
+
+	// Own is the number of own packets dropped with OwnFilter.
+	Own uint64
+
+	// Duplicates is the number of packets merged into an earlier copy by
+	// WithDeduplication.
+	Duplicates uint64
+}
+
+type stats struct {
+	received          atomic.Uint64
+	dropped           atomic.Uint64
+	invalidOpcode     atomic.Uint64
+	invalidRcode      atomic.Uint64
+	invalidSourcePort atomic.Uint64
+	ignoredQuestions  atomic.Uint64
+	invalidHopLimit   atomic.Uint64
+	offLink           atomic.Uint64
+	rateLimited       atomic.Uint64
+	cacheRejected     atomic.Uint64
+	own               atomic.Uint64
+	duplicates        atomic.Uint64
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{
+		Received: s.received.Load(),
+		Dropped:  s.dropped.Load(),
+
+		InvalidOpcode:     s.invalidOpcode.Load(),
+		InvalidRcode:      s.invalidRcode.Load(),
+		InvalidSourcePort: s.invalidSourcePort.Load(),
+		IgnoredQuestions:  s.ignoredQuestions.Load(),
+
+		InvalidHopLimit: s.invalidHopLimit.Load(),
+		OffLink:         s.offLink.Load(),
+
+		RateLimited:   s.rateLimited.Load(),
+		CacheRejected: s.cacheRejected.Load(),
+
+		Own:        s.own.Load(),
+		Duplicates: s.duplicates.Load(),
+	}
+}
+
+// Stats returns a snapshot of the packet counters of m.
+func (m *mDNS) Stats() Stats {
+	return m.stats.snapshot()
+}
@@ -0,0 +1,150 @@
+package mdns
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ValidationRule is a set of the checks that RFC 6762 §18 asks receivers to
+// make before acting on a message.
+type ValidationRule uint
+
+const (
+	// ValidateOpcode drops messages with a non-zero opcode (§18.3).
+	ValidateOpcode ValidationRule = 1 << iota
+
+	// ValidateRcode drops messages with a non-zero response code (§18.11).
+	ValidateRcode
+
+	// ValidateSourcePort drops responses that were not sent from the mDNS
+	// port (§6), which is 5353 unless changed with WithPort.
+	ValidateSourcePort
+
+	// ValidateResponseQuestions clears the questions of responses before the
+	// handlers see them (§6).
+	ValidateResponseQuestions
+
+	// ValidateAll enables the rules above. It is the default.
+	ValidateAll = ValidateOpcode | ValidateRcode | ValidateSourcePort | ValidateResponseQuestions
+)
+
+// Checks against packets spoofed from off-link (RFC 6762 §11). They are not
+// part of ValidateAll, as many senders leave the multicast TTL at 1; this
+// package sends with 255 unless WithMulticastTTL says otherwise. Both need
+// packet metadata that only the sockets of the default transport report;
+// packets without it are let through.
+const (
+	// ValidateHopLimit drops packets whose IP TTL (IPv4) or hop limit (IPv6)
+	// is not 255.
+	ValidateHopLimit ValidationRule = ValidateResponseQuestions << (iota + 1)
+
+	// ValidateSourceAddress drops packets whose source address is not
+	// link-local or in a subnet of the interface they arrived on.
+	ValidateSourceAddress
+)
+
+// subnetTTL is how long the addresses of an interface are cached by
+// ValidateSourceAddress.
+const subnetTTL = 30 * time.Second
+
+// validate applies the validation rules of m to message and reports whether it
+// should be handled. The packets dropped and the questions ignored are
+// counted in the stats of m, and the drops reported through OnDrop.
+func (m *mDNS) validate(src net.Addr, message *Message) bool {
+	var rules = m.validation
+
+	if rules&ValidateOpcode != 0 && message.Header.OpCode != 0 {
+		m.stats.invalidOpcode.Add(1)
+		m.drop(src, ReasonOpcode)
+		return false
+	}
+	if rules&ValidateRcode != 0 && message.Header.RCode != 0 {
+		m.stats.invalidRcode.Add(1)
+		m.drop(src, ReasonRcode)
+		return false
+	}
+	if rules&ValidateHopLimit != 0 && message.HopLimit != 0 && message.HopLimit != 255 {
+		m.stats.invalidHopLimit.Add(1)
+		m.drop(src, ReasonHopLimit)
+		m.warn(src, &ValidationError{Reason: ReasonHopLimit, HopLimit: message.HopLimit, IfIndex: message.IfIndex})
+		return false
+	}
+	if rules&ValidateSourceAddress != 0 && message.IfIndex != 0 && !m.subnets.onLink(src, message.IfIndex, m.clock.Now()) {
+		m.stats.offLink.Add(1)
+		m.drop(src, ReasonOffLink)
+		m.warn(src, &ValidationError{Reason: ReasonOffLink, HopLimit: message.HopLimit, IfIndex: message.IfIndex})
+		return false
+	}
+	if !message.Header.Response {
+		return true
+	}
+
+	if rules&ValidateSourcePort != 0 {
+		if addr, ok := src.(*net.UDPAddr); ok && addr.Port != m.port {
+			m.stats.invalidSourcePort.Add(1)
+			m.drop(src, ReasonSourcePort)
+			return false
+		}
+	}
+	if rules&ValidateResponseQuestions != 0 && len(message.Questions) > 0 {
+		message.Questions = nil
+		m.stats.ignoredQuestions.Add(1)
+	}
+	return true
+}
+
+// subnetCache holds the subnets of the interfaces packets arrive on.
+type subnetCache struct {
+	mu      sync.Mutex
+	entries map[int]subnetEntry
+}
+
+type subnetEntry struct {
+	nets    []*net.IPNet
+	fetched time.Time
+}
+
+// onLink reports whether src is link-local or in a subnet of the interface
+// with index ifIndex.
+func (c *subnetCache) onLink(src net.Addr, ifIndex int, now time.Time) bool {
+	var addr, ok = src.(*net.UDPAddr)
+	if !ok {
+		return true
+	}
+	if addr.IP.IsLinkLocalUnicast() {
+		return true
+	}
+
+	for _, subnet := range c.get(ifIndex, now) {
+		if subnet.Contains(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *subnetCache) get(ifIndex int, now time.Time) []*net.IPNet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[ifIndex]; ok && now.Sub(entry.fetched) < subnetTTL {
+		return entry.nets
+	}
+
+	var nets []*net.IPNet
+	if iface, err := net.InterfaceByIndex(ifIndex); err == nil {
+		var addrs, _ = iface.Addrs()
+		for _, addr := range addrs {
+			if subnet, ok := addr.(*net.IPNet); ok {
+				nets = append(nets, subnet)
+			}
+		}
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[int]subnetEntry)
+	}
+	c.entries[ifIndex] = subnetEntry{nets: nets, fetched: now}
+	return nets
+}
@@ -0,0 +1,170 @@
+package mdns
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/smartwalle/mdns/internal"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// validationResult is what happened to a packet passed to handle.
+type validationResult struct {
+	messages []Message
+	drops    []DropReason
+	warnings []error
+}
+
+// handleValidated passes packet to a new mDNS with the given rules
+// and returns what it did.
+func handleValidated(t *testing.T, rules ValidationRule, packet internal.Packet) (validationResult, Stats) {
+	t.Helper()
+	var m = newMDNS()
+	WithValidation(rules)(m)
+
+	var result validationResult
+	m.OnMessage(func(src net.Addr, message Message) {
+		result.messages = append(result.messages, message)
+	})
+	m.OnDrop(func(src net.Addr, reason DropReason) {
+		result.drops = append(result.drops, reason)
+	})
+	m.OnWarning(func(src net.Addr, err error) {
+		result.warnings = append(result.warnings, err)
+	})
+
+	var parser dnsmessage.Parser
+	m.handle(&parser, packet)
+	return result, m.Stats()
+}
+
+func packMessage(t *testing.T, message dnsmessage.Message) []byte {
+	t.Helper()
+	var data, err = message.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestValidate(t *testing.T) {
+	var question = dnsmessage.Question{Name: dnsmessage.MustNewName("printer.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}
+	var mDNSPeer = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: Port}
+	var resolver = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 49152}
+
+	var tests = []struct {
+		name      string
+		rules     ValidationRule
+		src       *net.UDPAddr
+		header    dnsmessage.Header
+		drop      []DropReason
+		stats     Stats
+		questions int
+	}{
+		{name: "query", rules: ValidateAll, src: mDNSPeer, questions: 1},
+		{name: "opcode", rules: ValidateAll, src: mDNSPeer, header: dnsmessage.Header{OpCode: 1}, drop: []DropReason{ReasonOpcode}, stats: Stats{InvalidOpcode: 1}},
+		{name: "opcode allowed", rules: ValidateAll &^ ValidateOpcode, src: mDNSPeer, header: dnsmessage.Header{OpCode: 1}, questions: 1},
+		{name: "rcode", rules: ValidateAll, src: mDNSPeer, header: dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeNameError}, drop: []DropReason{ReasonRcode}, stats: Stats{InvalidRcode: 1}},
+		{name: "rcode allowed", rules: ValidateAll &^ ValidateRcode, src: mDNSPeer, header: dnsmessage.Header{RCode: dnsmessage.RCodeNameError}, questions: 1},
+		{name: "response source port", rules: ValidateAll, src: resolver, header: dnsmessage.Header{Response: true}, drop: []DropReason{ReasonSourcePort}, stats: Stats{InvalidSourcePort: 1}},
+		{name: "query source port", rules: ValidateAll, src: resolver, questions: 1},
+		{name: "response questions", rules: ValidateAll, src: mDNSPeer, header: dnsmessage.Header{Response: true}, stats: Stats{IgnoredQuestions: 1}},
+		{name: "response questions kept", rules: ValidateAll &^ ValidateResponseQuestions, src: mDNSPeer, header: dnsmessage.Header{Response: true}, questions: 1},
+		{name: "no rules", rules: 0, src: resolver, header: dnsmessage.Header{Response: true, OpCode: 1, RCode: dnsmessage.RCodeNameError}, questions: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data = packMessage(t, dnsmessage.Message{Header: tt.header, Questions: []dnsmessage.Question{question}})
+			var result, stats = handleValidated(t, tt.rules, internal.Packet{Data: data, Addr: tt.src})
+
+			if !reflect.DeepEqual(result.drops, tt.drop) {
+				t.Fatalf("dropped with %v, want %v", result.drops, tt.drop)
+			}
+			if tt.drop != nil {
+				if len(result.messages) != 0 {
+					t.Fatalf("delivered %d messages, want none", len(result.messages))
+				}
+			} else if len(result.messages) != 1 || len(result.messages[0].Questions) != tt.questions {
+				t.Fatalf("delivered %d messages, want one with %d questions", len(result.messages), tt.questions)
+			}
+			if stats != tt.stats {
+				t.Fatalf("stats %+v, want %+v", stats, tt.stats)
+			}
+		})
+	}
+}
+
+// loopback returns the index of a loopback interface with an IPv4 address.
+func loopback(t *testing.T) int {
+	t.Helper()
+	var ifaces, err = net.Interfaces()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 {
+			continue
+		}
+		var addrs, _ = iface.Addrs()
+		for _, addr := range addrs {
+			if subnet, ok := addr.(*net.IPNet); ok && subnet.IP.To4() != nil {
+				return iface.Index
+			}
+		}
+	}
+	t.Skip("no IPv4 loopback interface")
+	return 0
+}
+
+func TestValidateLink(t *testing.T) {
+	var index = loopback(t)
+	var onLink = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: Port}
+	var offLink = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: Port}
+	var linkLocal = &net.UDPAddr{IP: net.ParseIP("fe80::2"), Port: Port}
+	var rules = ValidateAll | ValidateHopLimit | ValidateSourceAddress
+
+	var tests = []struct {
+		name     string
+		rules    ValidationRule
+		src      *net.UDPAddr
+		hopLimit int
+		ifIndex  int
+		err      *ValidationError
+		stats    Stats
+	}{
+		{name: "valid", rules: rules, src: onLink, hopLimit: 255, ifIndex: index},
+		{name: "hop limit", rules: rules, src: onLink, hopLimit: 1, ifIndex: index, err: &ValidationError{Reason: ReasonHopLimit, HopLimit: 1, IfIndex: index}, stats: Stats{InvalidHopLimit: 1}},
+		{name: "hop limit unknown", rules: rules, src: onLink, ifIndex: index},
+		{name: "hop limit not checked", rules: ValidateAll, src: onLink, hopLimit: 1, ifIndex: index},
+		{name: "off-link", rules: rules, src: offLink, hopLimit: 255, ifIndex: index, err: &ValidationError{Reason: ReasonOffLink, HopLimit: 255, IfIndex: index}, stats: Stats{OffLink: 1}},
+		{name: "link-local", rules: rules, src: linkLocal, hopLimit: 255, ifIndex: index},
+		{name: "interface unknown", rules: rules, src: offLink, hopLimit: 255},
+		{name: "source not checked", rules: ValidateAll | ValidateHopLimit, src: offLink, hopLimit: 255, ifIndex: index},
+	}
+	var data = packMessage(t, dnsmessage.Message{Header: dnsmessage.Header{Response: true}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result, stats = handleValidated(t, tt.rules, internal.Packet{Data: data, Addr: tt.src, HopLimit: tt.hopLimit, IfIndex: tt.ifIndex})
+
+			if tt.err == nil {
+				if len(result.messages) != 1 || len(result.drops) != 0 || len(result.warnings) != 0 {
+					t.Fatalf("delivered %d messages, dropped with %v and warned %v, want the message delivered", len(result.messages), result.drops, result.warnings)
+				}
+				return
+			}
+			var vErr *ValidationError
+			if len(result.messages) != 0 || !reflect.DeepEqual(result.drops, []DropReason{tt.err.Reason}) ||
+				len(result.warnings) != 1 || !errors.As(result.warnings[0], &vErr) {
+				t.Fatalf("delivered %d messages, dropped with %v and warned %v, want a drop and a *ValidationError", len(result.messages), result.drops, result.warnings)
+			}
+			if *vErr != *tt.err {
+				t.Fatalf("warned %+v, want %+v", *vErr, *tt.err)
+			}
+			if stats != tt.stats {
+				t.Fatalf("stats %+v, want %+v", stats, tt.stats)
+			}
+		})
+	}
+}